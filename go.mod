@@ -3,14 +3,20 @@ module github.com/ibp-network/ibp-geodns-agent
 go 1.24.2
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/fxamacker/cbor/v2 v2.9.2
+	github.com/go-sql-driver/mysql v1.9.3
 	github.com/ibp-network/ibp-geodns-libs v0.7.0
+	github.com/klauspost/compress v1.18.3
 	github.com/nats-io/nats.go v1.48.0
+	github.com/nats-io/nkeys v0.4.12
+	go.etcd.io/bbolt v1.4.3
 )
 
 require (
-	github.com/klauspost/compress v1.18.3 // indirect
-	github.com/nats-io/nkeys v0.4.12 // indirect
+	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/nats-io/nuid v1.0.1 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
 	golang.org/x/crypto v0.47.0 // indirect
 	golang.org/x/sys v0.40.0 // indirect
 )
@@ -0,0 +1,263 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/metrics"
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+)
+
+// Operator actions that can be triggered remotely
+const (
+	ActionCheck       = "check"
+	ActionPause       = "pause"
+	ActionResume      = "resume"
+	ActionReport      = "report"
+	ActionReload      = "reload"
+	ActionSetLogLevel = "set-log-level"
+)
+
+// AuditEvent records an operator action and is published to agent.audit.<AgentID>
+type AuditEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	AgentID       string    `json:"agent_id"`
+	BootID        string    `json:"boot_id"`
+	Sequence      uint64    `json:"sequence"` // increases by one with every audit event published since boot
+	Timestamp     time.Time `json:"timestamp"`
+	Source        string    `json:"source"` // http, nats
+	Actor         string    `json:"actor"`
+	Action        string    `json:"action"`
+	Target        string    `json:"target,omitempty"`
+	Result        string    `json:"result"` // ok, error
+	Error         string    `json:"error,omitempty"`
+}
+
+// audit logs an operator action and publishes it as an audit event
+func (a *Agent) audit(source, actor, action, target string, err error) {
+	event := AuditEvent{
+		SchemaVersion: reporter.SchemaVersion,
+		AgentID:       a.config().Agent.AgentID,
+		BootID:        a.reporter.BootID(),
+		Sequence:      a.auditSequence.Add(1),
+		Timestamp:     time.Now(),
+		Source:        source,
+		Actor:         actor,
+		Action:        action,
+		Target:        target,
+		Result:        "ok",
+	}
+	if err != nil {
+		event.Result = "error"
+		event.Error = err.Error()
+	}
+
+	logging.Info("Admin action", "source", source, "actor", actor, "action", action, "target", target, "result", event.Result, "error", event.Error)
+
+	data, marshalErr := json.Marshal(event)
+	if marshalErr != nil {
+		logging.Error("Failed to marshal audit event", "error", marshalErr)
+		return
+	}
+	subject := a.subjects.Audit(a.config().Agent.AgentID)
+	if pubErr := nats.Publish(subject, data); pubErr != nil {
+		logging.Warn("Failed to publish audit event", "error", pubErr, "subject", subject)
+	}
+}
+
+// findService returns the configured service with the given name
+func (a *Agent) findService(name string) (config.ServiceConfig, error) {
+	for _, service := range a.config().Services() {
+		if service.Name == name {
+			return service, nil
+		}
+	}
+	return config.ServiceConfig{}, inputErrorf("unknown service %q", name)
+}
+
+// CheckNow checks the named service immediately, or every service if name is
+// empty, and returns the results. Paused services are checked too, since the
+// operator asked for them explicitly.
+func (a *Agent) CheckNow(ctx context.Context, name string) (map[string]reporter.ServiceStatus, error) {
+	services := a.config().Services()
+	if name != "" {
+		service, err := a.findService(name)
+		if err != nil {
+			return nil, err
+		}
+		services = []config.ServiceConfig{service}
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]reporter.ServiceStatus, len(services))
+	)
+	for _, service := range services {
+		wg.Add(1)
+		go func(service config.ServiceConfig) {
+			defer wg.Done()
+			status, ok := a.checkService(ctx, service)
+			if !ok {
+				return
+			}
+			mu.Lock()
+			results[service.Name] = status
+			mu.Unlock()
+		}(service)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// Pause stops scheduled checks of the named service until Resume is called
+func (a *Agent) Pause(name string) error {
+	if _, err := a.findService(name); err != nil {
+		return err
+	}
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	a.paused[name] = true
+	return nil
+}
+
+// Resume re-enables scheduled checks of the named service
+func (a *Agent) Resume(name string) error {
+	if _, err := a.findService(name); err != nil {
+		return err
+	}
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	delete(a.paused, name)
+	return nil
+}
+
+// isPaused reports whether scheduled checks of the named service are paused
+func (a *Agent) isPaused(name string) bool {
+	a.stateMu.RLock()
+	defer a.stateMu.RUnlock()
+	return a.paused[name]
+}
+
+// pausedServices returns the names of all paused services
+func (a *Agent) pausedServices() []string {
+	a.stateMu.RLock()
+	defer a.stateMu.RUnlock()
+	names := make([]string, 0, len(a.paused))
+	for name := range a.paused {
+		names = append(names, name)
+	}
+	return names
+}
+
+// ForceReport publishes a report immediately
+func (a *Agent) ForceReport() error {
+	return a.reporter.SendNow()
+}
+
+// ReloadConfig re-reads the configuration file and reapplies the overlays.
+// The services and their settings, the log level, the signing seed and
+// command keys, delta reports, report encoding, history retention and the
+// shutdown and drain timeouts take effect immediately. The NATS connection, health server, check, report and
+// reload intervals, consensus quorum and window, trusted peer keys, and the
+// History, Mysql and Matrix sections keep their startup values until a
+// restart.
+func (a *Agent) ReloadConfig() error {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	previous := a.config()
+	return a.applyReload(previous, a.configs.Reload())
+}
+
+// applyReload records the outcome of a configuration reload and applies
+// the new configuration to the running agent. a.reloadMu must be held.
+func (a *Agent) applyReload(previous *config.Config, err error) error {
+	a.setConfigError(err)
+	if err != nil {
+		logging.Error("Failed to reload configuration", "error", err)
+		return err
+	}
+
+	if err := a.updateSigner(); err != nil {
+		logging.Error("Failed to load signing key; keeping the previous key", "error", err)
+	}
+
+	// A level set with --log-level or at runtime stays in effect until the
+	// configured level itself changes
+	cfg := a.config()
+	if level := cfg.LogLevel(); level != previous.LogLevel() {
+		logging.Info("Log level changed by configuration", "level", level)
+		logging.SetLevel(level)
+	}
+
+	services := cfg.Services()
+	names := make([]string, 0, len(services))
+	for _, service := range services {
+		names = append(names, service.Name)
+	}
+	metrics.SetServices(names)
+	a.reporter.RetainServices(names)
+	for _, change := range a.incidents.Retain(names, time.Now()) {
+		a.recordChange(change)
+	}
+
+	a.stateMu.Lock()
+	for name := range a.paused {
+		if !containsString(names, name) {
+			delete(a.paused, name)
+		}
+	}
+	a.stateMu.Unlock()
+
+	logging.Info("Configuration reloaded", "path", cfg.Path(), "hash", cfg.Hash(), "overlays", len(cfg.Overlays()), "services", len(services))
+	return nil
+}
+
+// SetLogLevel changes the log level at runtime
+func (a *Agent) SetLogLevel(level string) error {
+	if _, ok := logging.ParseLevel(level); !ok {
+		return inputErrorf("unknown log level %q", level)
+	}
+	logging.SetLevel(level)
+	return nil
+}
+
+// inputError is an error caused by the request rather than by the agent,
+// such as an unknown service name
+type inputError struct {
+	msg string
+}
+
+func (e *inputError) Error() string {
+	return e.msg
+}
+
+func inputErrorf(format string, args ...interface{}) error {
+	return &inputError{msg: fmt.Sprintf(format, args...)}
+}
+
+// isInputError reports whether err was caused by the request
+func isInputError(err error) bool {
+	var inputErr *inputError
+	return errors.As(err, &inputErr)
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
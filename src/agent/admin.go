@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/health"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+)
+
+// adminResponse is the JSON body returned by every admin endpoint
+type adminResponse struct {
+	OK     bool        `json:"ok"`
+	Action string      `json:"action"`
+	Target string      `json:"target,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Result interface{} `json:"result,omitempty"`
+}
+
+// registerAdmin registers the admin API on the health server. The health
+// server refuses these routes unless authentication is configured.
+func (a *Agent) registerAdmin() {
+	a.health.HandleAdmin("/admin/check", a.adminHandler(ActionCheck, "service", false, func(r *http.Request, target string) (interface{}, error) {
+		return a.CheckNow(r.Context(), target)
+	}))
+	a.health.HandleAdmin("/admin/pause", a.adminHandler(ActionPause, "service", true, func(r *http.Request, target string) (interface{}, error) {
+		return nil, a.Pause(target)
+	}))
+	a.health.HandleAdmin("/admin/resume", a.adminHandler(ActionResume, "service", true, func(r *http.Request, target string) (interface{}, error) {
+		return nil, a.Resume(target)
+	}))
+	a.health.HandleAdmin("/admin/report", a.adminHandler(ActionReport, "", false, func(r *http.Request, target string) (interface{}, error) {
+		return nil, a.ForceReport()
+	}))
+	a.health.HandleAdmin("/admin/reload", a.adminHandler(ActionReload, "", false, func(r *http.Request, target string) (interface{}, error) {
+		if err := a.ReloadConfig(); err != nil {
+			return nil, err
+		}
+		return map[string]string{"config_hash": a.config().Hash()}, nil
+	}))
+	a.health.HandleAdmin("/admin/loglevel", a.adminHandler(ActionSetLogLevel, "level", true, func(r *http.Request, target string) (interface{}, error) {
+		return nil, a.SetLogLevel(target)
+	}))
+}
+
+// adminHandler wraps an admin action: it enforces POST, reads the target from
+// the named query parameter, audits the outcome and writes an adminResponse
+func (a *Agent) adminHandler(action, param string, targetRequired bool, run func(*http.Request, string) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeAdminResponse(w, http.StatusMethodNotAllowed, adminResponse{Action: action, Error: "method not allowed"})
+			return
+		}
+
+		target := ""
+		if param != "" {
+			target = r.URL.Query().Get(param)
+		}
+		if targetRequired && target == "" {
+			writeAdminResponse(w, http.StatusBadRequest, adminResponse{Action: action, Error: "missing " + param + " parameter"})
+			return
+		}
+
+		result, err := run(r, target)
+		a.audit("http", health.Principal(r), action, target, err)
+
+		resp := adminResponse{OK: err == nil, Action: action, Target: target, Result: result}
+		code := http.StatusOK
+		switch {
+		case err == nil:
+		case isInputError(err):
+			resp.Error = err.Error()
+			code = http.StatusBadRequest
+		default:
+			// Reload, publish and KV failures are the agent's, not the caller's
+			resp.Error = err.Error()
+			code = http.StatusInternalServerError
+		}
+		writeAdminResponse(w, code, resp)
+	}
+}
+
+func writeAdminResponse(w http.ResponseWriter, code int, resp adminResponse) {
+	writeJSON(w, code, resp)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		logging.Error("Failed to marshal response", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
@@ -3,22 +3,70 @@ package agent
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/consensus"
+	"github.com/ibp-network/ibp-geodns-agent/src/database"
+	"github.com/ibp-network/ibp-geodns-agent/src/fleet"
 	"github.com/ibp-network/ibp-geodns-agent/src/health"
+	"github.com/ibp-network/ibp-geodns-agent/src/history"
+	"github.com/ibp-network/ibp-geodns-agent/src/hostmetrics"
+	"github.com/ibp-network/ibp-geodns-agent/src/incidents"
 	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/matrix"
+	"github.com/ibp-network/ibp-geodns-agent/src/metrics"
 	"github.com/ibp-network/ibp-geodns-agent/src/nats"
 	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+	"github.com/ibp-network/ibp-geodns-agent/src/signing"
+	"github.com/ibp-network/ibp-geodns-agent/src/subjects"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/micro"
 )
 
 // Agent represents the main agent instance
 type Agent struct {
-	config   *config.Config
-	reporter *reporter.Reporter
-	health   *health.Server
-	ctx      context.Context
-	cancel   context.CancelFunc
+	configs   *config.Store
+	reporter  *reporter.Reporter
+	health    *health.Server
+	subjects  subjects.Builder
+	peers     *fleet.Registry
+	consensus *consensus.Tracker
+	sla       *slaTracker
+	keys      *signing.KeyRing
+	host      *hostmetrics.Collector
+	history   *history.Store
+	incidents *incidents.Tracker
+	database  *database.Sink
+	notifier  *matrix.Notifier
+	flaps     *flapTracker
+	service   micro.Service
+	ctx       context.Context
+	cancel    context.CancelFunc
+	subs      []*natsgo.Subscription
+
+	// Checks run under their own context so shutdown can stop scheduling
+	// new checks while letting running ones finish
+	checkCtx       context.Context
+	checkCancel    context.CancelFunc
+	checksInFlight atomic.Int64
+	stopping       atomic.Bool
+
+	version    map[string]string
+	signingKey string
+	startedAt  time.Time
+
+	reloadMu sync.Mutex
+
+	stateMu        sync.RWMutex
+	configErr      error
+	paused         map[string]bool
+	firstCycleDone atomic.Bool
+	auditSequence  atomic.Uint64
+	resultDropLog  atomic.Int64 // Unix nanoseconds of the last dropped-result warning
 }
 
 const defaultCheckIntervalSeconds = 30
@@ -31,25 +79,53 @@ func New(cfg *config.Config) (*Agent, error) {
 	}
 
 	// Initialize reporter
-	rep, err := reporter.New(cfg)
+	configs := config.NewStore(cfg)
+	rep, err := reporter.New(configs)
 	if err != nil {
 		nats.Disconnect()
 		return nil, fmt.Errorf("failed to create reporter: %w", err)
 	}
 
 	// Initialize health server
-	healthServer := health.New(cfg.Agent.HealthCheckPort)
+	healthServer := health.New(cfg.Agent.HealthCheckPort, cfg.Agent.HealthServer)
 
-	return &Agent{
-		config:   cfg,
-		reporter: rep,
-		health:   healthServer,
-	}, nil
+	registerMetrics(cfg)
+
+	var tracker *consensus.Tracker
+	if cfg.Agent.Consensus.Enabled {
+		tracker = consensus.NewTracker(cfg.Agent.Consensus.Quorum, time.Duration(cfg.Agent.Consensus.Window)*time.Second, cfg.Agent.Consensus.DistinctRegions)
+	}
+
+	a := &Agent{
+		configs:   configs,
+		reporter:  rep,
+		health:    healthServer,
+		subjects:  subjects.New(cfg.Nats.SubjectPrefix),
+		peers:     fleet.NewRegistry(time.Duration(cfg.Agent.PeerLostThreshold) * time.Second),
+		consensus: tracker,
+		sla:       newSLATracker(),
+		keys:      signing.NewKeyRing(cfg.Agent.Signing.TrustedKeys),
+		host:      hostmetrics.NewCollector(),
+		incidents: incidents.NewTracker(),
+		paused:    make(map[string]bool),
+	}
+	rep.SetMetricsProvider(a.reportMetrics)
+	return a, nil
+}
+
+// config returns the configuration in effect. Callers reading several
+// settings that belong together should keep the result rather than call it
+// again, since a reload may replace it in between.
+func (a *Agent) config() *config.Config {
+	return a.configs.Current()
 }
 
 // Start starts the agent
 func (a *Agent) Start(ctx context.Context) error {
-	logging.Info("Starting agent", "agentID", a.config.Agent.AgentID)
+	logging.Info("Starting agent", "agentID", a.config().Agent.AgentID, "subjectPrefix", a.subjects.Prefix())
+	if token := subjects.Token(a.config().Agent.AgentID); token != a.config().Agent.AgentID {
+		logging.Warn("AgentID contains characters not allowed in NATS subjects; using escaped token", "agentID", a.config().Agent.AgentID, "token", token)
+	}
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -57,12 +133,28 @@ func (a *Agent) Start(ctx context.Context) error {
 		a.cancel()
 	}
 	a.ctx, a.cancel = context.WithCancel(ctx)
+	a.checkCtx, a.checkCancel = context.WithCancel(context.WithoutCancel(ctx))
+	a.stopping.Store(false)
+
+	a.startedAt = time.Now()
+	a.health.SetStatusProvider(func() interface{} { return a.Status() })
+	a.registerConditions()
+	a.registerAdmin()
+	a.registerPprof()
+	a.health.Handle("/history", http.HandlerFunc(a.historyHandler))
 
 	// Start health server
 	if err := a.health.Start(); err != nil {
 		return fmt.Errorf("failed to start health server: %w", err)
 	}
 
+	// Sign everything published from here on
+	if err := a.startSigning(); err != nil {
+		_ = a.health.Stop(context.Background())
+		a.cancel()
+		return fmt.Errorf("failed to start message signing: %w", err)
+	}
+
 	// Start reporter
 	if err := a.reporter.Start(a.ctx); err != nil {
 		a.health.SetReady(false)
@@ -73,6 +165,48 @@ func (a *Agent) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to start reporter: %w", err)
 	}
 
+	// Start remote command channel
+	if err := a.startCommands(); err != nil {
+		logging.Warn("Remote commands unavailable", "error", err)
+	}
+
+	// Answer snapshot requests from consumers of delta reports
+	if err := a.startSnapshots(); err != nil {
+		logging.Warn("Snapshot requests unavailable", "error", err)
+	}
+
+	// Register with NATS service discovery
+	if err := a.startService(); err != nil {
+		logging.Warn("NATS service discovery unavailable", "error", err)
+	}
+
+	// Start peer tracking
+	if err := a.startPeers(a.ctx); err != nil {
+		logging.Warn("Peer tracking unavailable", "error", err)
+	}
+
+	// Start exchanging observations with other agents
+	if err := a.startConsensus(a.ctx); err != nil {
+		logging.Warn("Consensus unavailable; using local results only", "error", err)
+		a.consensus = nil
+	}
+
+	// Open the check history before the first results arrive
+	if err := a.startHistory(a.ctx); err != nil {
+		logging.Warn("Check history unavailable", "error", err)
+	}
+	if err := a.startDatabase(); err != nil {
+		logging.Warn("MySQL persistence unavailable", "error", err)
+	}
+	if err := a.startNotifications(a.ctx); err != nil {
+		logging.Warn("Matrix notifications unavailable", "error", err)
+	}
+
+	// Apply overrides from the config bucket before the first check cycle
+	if err := a.startConfigKV(a.ctx); err != nil {
+		logging.Warn("Config bucket unavailable; using the file configuration", "error", err)
+	}
+
 	// Start monitoring loop
 	go a.monitorLoop(a.ctx)
 
@@ -85,36 +219,82 @@ func (a *Agent) Start(ctx context.Context) error {
 	return nil
 }
 
-// Stop stops the agent gracefully
+// ShutdownTimeout returns Agent.ShutdownTimeout of the configuration in
+// effect, so a reload changes the time allowed for the next Stop
+func (a *Agent) ShutdownTimeout() time.Duration {
+	return time.Duration(a.config().Agent.ShutdownTimeout) * time.Second
+}
+
+// Stop shuts the agent down in order: stop scheduling checks and accepting
+// commands, wait for in-flight checks up to Agent.CheckDrainTimeout, publish
+// a final offline report, drain NATS, then stop the health server. Steps
+// still pending when ctx expires are cut short.
 func (a *Agent) Stop(ctx context.Context) error {
 	logging.Info("Stopping agent")
+	a.health.SetReady(false)
 
-	// Cancel context
+	// Stop scheduling checks, reloads and peer sweeps
+	a.stopping.Store(true)
 	if a.cancel != nil {
 		a.cancel()
 	}
-	a.health.SetReady(false)
 
-	// Stop reporter
+	// Stop accepting commands and observations, finishing those already received
+	a.stopService()
+	if err := nats.DrainSubscriptions(ctx, a.subs); err != nil {
+		logging.Warn("Subscriptions not drained before shutdown deadline", "error", err)
+	}
+	a.subs = nil
+
+	a.waitForChecks(ctx)
+	a.stopHistory()
+	a.stopDatabase(ctx)
+
+	// Publish the final offline report
 	if err := a.reporter.Stop(ctx); err != nil {
 		logging.Error("Error stopping reporter", "error", err)
 	}
 
+	// Flush pending publishes and close the NATS connection
+	if err := nats.Drain(ctx); err != nil {
+		logging.Warn("NATS connection not drained cleanly", "error", err)
+	}
+
 	// Stop health server
 	if err := a.health.Stop(ctx); err != nil {
 		logging.Error("Error stopping health server", "error", err)
 	}
 
-	// Close NATS connection
-	nats.Disconnect()
-
 	logging.Info("Agent stopped")
 	return nil
 }
 
+// waitForChecks waits for running checks to finish, up to
+// Agent.CheckDrainTimeout or the end of ctx, then cancels the rest
+func (a *Agent) waitForChecks(ctx context.Context) {
+	if a.checkCancel == nil {
+		return
+	}
+	defer a.checkCancel()
+
+	drainCtx, cancel := context.WithTimeout(ctx, time.Duration(a.config().Agent.CheckDrainTimeout)*time.Second)
+	defer cancel()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for a.checksInFlight.Load() > 0 {
+		select {
+		case <-drainCtx.Done():
+			logging.Warn("Cancelling checks still running at shutdown", "inFlight", a.checksInFlight.Load())
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 // monitorLoop runs the main monitoring loop
 func (a *Agent) monitorLoop(ctx context.Context) {
-	intervalSec := a.config.Agent.CheckInterval
+	intervalSec := a.config().Agent.CheckInterval
 	if intervalSec <= 0 {
 		logging.Warn("Invalid check interval; using default", "configuredSeconds", intervalSec, "defaultSeconds", defaultCheckIntervalSeconds)
 		intervalSec = defaultCheckIntervalSeconds
@@ -124,46 +304,81 @@ func (a *Agent) monitorLoop(ctx context.Context) {
 	defer ticker.Stop()
 
 	// Run initial check
-	a.performChecks()
+	a.performChecks(a.checkCtx)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			a.performChecks()
+			a.performChecks(a.checkCtx)
 		}
 	}
 }
 
 // performChecks performs health checks on all configured services
-func (a *Agent) performChecks() {
+func (a *Agent) performChecks(ctx context.Context) {
 	logging.Debug("Performing service checks")
 
-	for _, service := range a.config.Agent.ServicesToMonitor {
-		go a.checkService(service)
+	var wg sync.WaitGroup
+	for _, service := range a.config().Services() {
+		if a.isPaused(service.Name) {
+			logging.Debug("Skipping paused service", "service", service.Name)
+			continue
+		}
+		wg.Add(1)
+		go func(service config.ServiceConfig) {
+			defer wg.Done()
+			a.checkService(ctx, service)
+		}(service)
+	}
+
+	if a.firstCycleDone.Load() {
+		return
 	}
+	go func() {
+		wg.Wait()
+		if ctx.Err() == nil && !a.firstCycleDone.Swap(true) {
+			logging.Info("First check cycle completed")
+		}
+	}()
 }
 
-// checkService checks a single service
-func (a *Agent) checkService(service config.ServiceConfig) {
-	// This would implement actual service checking logic
-	// For now, it's a placeholder
+// checkService checks a single service and records the result with the
+// reporter. ok is false if the check was cancelled before it completed or
+// the agent is shutting down.
+func (a *Agent) checkService(ctx context.Context, service config.ServiceConfig) (status reporter.ServiceStatus, ok bool) {
+	if a.stopping.Load() {
+		return status, false
+	}
+	a.checksInFlight.Add(1)
+	defer a.checksInFlight.Add(-1)
+
 	logging.Debug("Checking service", "service", service.Name, "type", service.Type)
 
-	// TODO: Implement actual health checks based on service type
-	// - HTTP: Make HTTP request, check status code
-	// - TCP: Check TCP connection
-	// - Custom: Run custom check command
+	status = runCheck(ctx, service)
+	if ctx.Err() != nil {
+		// Shutting down; a cancelled check says nothing about the service
+		return status, false
+	}
+	metrics.ObserveCheck(service.Name, status.Status == "up", status.Latency())
+	status = a.applyConsensus(status)
+	a.reporter.ReportServiceStatus(service.Name, status)
+	a.sla.record(status)
+	a.recordHistory(status)
+	a.recordDatabase(status)
+	a.recordState(status)
+	a.notifyCheck(status)
+	return status, true
 }
 
 // configReloadLoop periodically reloads configuration
 func (a *Agent) configReloadLoop(ctx context.Context) {
-	if a.config.System.ConfigReloadTime <= 0 {
+	if a.config().System.ConfigReloadTime <= 0 {
 		return
 	}
 
-	ticker := time.NewTicker(time.Duration(a.config.System.ConfigReloadTime) * time.Second)
+	ticker := time.NewTicker(time.Duration(a.config().System.ConfigReloadTime) * time.Second)
 	defer ticker.Stop()
 
 	for {
@@ -172,7 +387,28 @@ func (a *Agent) configReloadLoop(ctx context.Context) {
 			return
 		case <-ticker.C:
 			logging.Debug("Reloading configuration")
-			// TODO: Implement config reload logic
+			_ = a.ReloadConfig()
 		}
 	}
 }
+
+// registerMetrics bounds service labels to the configured services and
+// registers metrics read from the NATS client at scrape time
+func registerMetrics(cfg *config.Config) {
+	services := cfg.Services()
+	names := make([]string, 0, len(services))
+	for _, service := range services {
+		names = append(names, service.Name)
+	}
+	metrics.SetServices(names)
+
+	metrics.RegisterCounterFunc("ibp_agent_nats_reconnects_total", "Number of times the NATS connection was re-established.", func() float64 {
+		return float64(nats.Reconnects())
+	})
+	metrics.RegisterGaugeFunc("ibp_agent_nats_callbacks_in_flight", "Number of NATS subscription callbacks currently running.", func() float64 {
+		return float64(nats.CallbacksInFlight())
+	})
+	metrics.RegisterGaugeFunc("ibp_agent_nats_callbacks_capacity", "Maximum number of concurrently running NATS subscription callbacks.", func() float64 {
+		return float64(nats.CallbackCapacity())
+	})
+}
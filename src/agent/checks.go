@@ -0,0 +1,168 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+)
+
+const (
+	defaultCheckTimeoutSeconds = 10
+	maxResponseBodyBytes       = 1 << 20
+
+	// maxCommandOutputBytes is how much of a custom check's output is kept
+	maxCommandOutputBytes = 1 << 20
+
+	// commandWaitDelay bounds the wait for a custom check's output once the
+	// command has exited or been killed, in case a child it started holds
+	// the output open
+	commandWaitDelay = time.Second
+)
+
+var checkHTTPClient = &http.Client{
+	// Redirects are followed; the timeout comes from the per-check context
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("stopped after %d redirects", len(via))
+		}
+		return nil
+	},
+}
+
+// runCheck executes a single check for service and returns its status
+func runCheck(ctx context.Context, service config.ServiceConfig) reporter.ServiceStatus {
+	timeoutSec := service.Timeout
+	if timeoutSec <= 0 {
+		timeoutSec = defaultCheckTimeoutSeconds
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeoutSec)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	var (
+		certExpiry *time.Time
+		err        error
+	)
+	switch strings.ToLower(service.Type) {
+	case config.ServiceTypeHTTP:
+		certExpiry, err = checkHTTP(ctx, service)
+	case config.ServiceTypeTCP:
+		err = checkTCP(ctx, service)
+	case config.ServiceTypeCustom:
+		err = checkCustom(ctx, service)
+	default:
+		err = fmt.Errorf("unsupported service type %q", service.Type)
+	}
+
+	status := reporter.ServiceStatus{
+		Name:          service.Name,
+		Status:        "up",
+		LatencyMs:     reporter.Milliseconds(time.Since(start)),
+		LastCheck:     start,
+		CertExpiresAt: certExpiry,
+	}
+	if err != nil {
+		status.Status = "down"
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// checkHTTP requests service.URL and compares the status code and, if
+// configured, the response body. It returns the expiry of the server
+// certificate for HTTPS URLs.
+func checkHTTP(ctx context.Context, service config.ServiceConfig) (*time.Time, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, service.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+	req.Header.Set("User-Agent", "ibp-geodns-agent")
+
+	resp, err := checkHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var certExpiry *time.Time
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		notAfter := resp.TLS.PeerCertificates[0].NotAfter
+		certExpiry = &notAfter
+	}
+
+	expected := service.ExpectedStatus
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	if resp.StatusCode != expected {
+		return certExpiry, fmt.Errorf("unexpected status code %d (expected %d)", resp.StatusCode, expected)
+	}
+
+	if service.ExpectedResponse != "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBodyBytes))
+		if err != nil {
+			return certExpiry, fmt.Errorf("failed to read response body: %w", err)
+		}
+		if !strings.Contains(string(body), service.ExpectedResponse) {
+			return certExpiry, fmt.Errorf("response does not contain expected content")
+		}
+	}
+	return certExpiry, nil
+}
+
+// checkTCP opens a TCP connection to service.Endpoint
+func checkTCP(ctx context.Context, service config.ServiceConfig) error {
+	var dialer net.Dialer
+	c, err := dialer.DialContext(ctx, "tcp", service.Endpoint)
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+// checkCustom runs service.Endpoint as a shell command; exit status 0 means up.
+// If ExpectedResponse is set the command output must contain it. The command
+// runs with the agent's privileges, so it must come from a trusted source.
+func checkCustom(ctx context.Context, service config.ServiceConfig) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", service.Endpoint)
+	cmd.WaitDelay = commandWaitDelay
+	output := &cappedBuffer{max: maxCommandOutputBytes}
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	// ErrWaitDelay means the command exited but a child kept its output
+	// open; the exit status still stands
+	if err := cmd.Run(); err != nil && !errors.Is(err, exec.ErrWaitDelay) {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("command failed: %w", err)
+	}
+	if service.ExpectedResponse != "" && !strings.Contains(output.buf.String(), service.ExpectedResponse) {
+		return fmt.Errorf("command output does not contain expected content")
+	}
+	return nil
+}
+
+// cappedBuffer keeps the first max bytes written to it and discards the rest
+type cappedBuffer struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
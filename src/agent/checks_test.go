@@ -0,0 +1,59 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+)
+
+func TestCheckCustom(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		expected string
+		timeout  int
+		err      string // substring of the error; empty if the check passes
+	}{
+		{"success", "true", "", 5, ""},
+		{"failure", "exit 3", "", 5, "exit status 3"},
+		{"expected output", "echo ready", "ready", 5, ""},
+		{"expected output on stderr", "echo ready >&2", "ready", 5, ""},
+		{"missing output", "echo starting", "ready", 5, "does not contain"},
+		{"output beyond the cap is dropped", "head -c 2000000 /dev/zero; echo ready", "ready", 5, "does not contain"},
+		{"timeout", "sleep 10", "", 1, "deadline exceeded"},
+		// The command exits at once but its child keeps stdout open
+		{"child holding the output", "sleep 10 & echo ready", "ready", 5, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := config.ServiceConfig{Name: "cmd", Type: config.ServiceTypeCustom, Endpoint: tt.command, ExpectedResponse: tt.expected, Timeout: tt.timeout}
+			start := time.Now()
+			status := runCheck(context.Background(), service)
+
+			if tt.err == "" && status.Status != "up" {
+				t.Errorf("status %s (%s), want up", status.Status, status.Error)
+			}
+			if tt.err != "" && (status.Status != "down" || !strings.Contains(status.Error, tt.err)) {
+				t.Errorf("status %s (%q), want down with %q", status.Status, status.Error, tt.err)
+			}
+			if limit := time.Duration(tt.timeout)*time.Second + 2*commandWaitDelay; time.Since(start) > limit {
+				t.Errorf("check took %s, more than %s", time.Since(start), limit)
+			}
+		})
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	b := &cappedBuffer{max: 5}
+	for _, s := range []string{"abc", "def", "ghi"} {
+		if n, err := b.Write([]byte(s)); n != len(s) || err != nil {
+			t.Errorf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if got := b.buf.String(); got != "abcde" {
+		t.Errorf("kept %q, want abcde", got)
+	}
+}
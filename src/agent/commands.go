@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/signing"
+	"github.com/ibp-network/ibp-geodns-agent/src/subjects"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+// Commands accepted on agent.cmd.<AgentID>.<command> and agent.cmd.all.<command>
+const (
+	CommandStatus      = "status"
+	CommandCheckNow    = "check-now"
+	CommandReload      = "reload"
+	CommandPause       = "pause"
+	CommandResume      = "resume"
+	CommandReport      = "report"
+	CommandSetLogLevel = "set-log-level"
+)
+
+// commandTimeout bounds how long a single command may run
+const commandTimeout = 60 * time.Second
+
+// commandMaxAge bounds how far the issued_at of a signed command may be from
+// the agent's clock, limiting how long a captured command can be replayed
+const commandMaxAge = 2 * time.Minute
+
+// CommandRequest is the optional JSON payload of a command
+type CommandRequest struct {
+	Service  string     `json:"service,omitempty"`
+	Level    string     `json:"level,omitempty"`
+	Actor    string     `json:"actor,omitempty"`     // informational; not trusted
+	IssuedAt *time.Time `json:"issued_at,omitempty"` // required for signed commands
+}
+
+// CommandResponse is the JSON reply to every command
+type CommandResponse struct {
+	AgentID string      `json:"agent_id"`
+	Command string      `json:"command"`
+	OK      bool        `json:"ok"`
+	Error   string      `json:"error,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+}
+
+// startCommands subscribes to the command subjects for this agent and for
+// the whole fleet
+func (a *Agent) startCommands() error {
+	patterns := []string{
+		a.subjects.Commands(a.config().Agent.AgentID),
+		a.subjects.Commands(subjects.Broadcast),
+	}
+
+	for _, subject := range patterns {
+		sub, err := nats.Subscribe(subject, a.handleCommand)
+		if err != nil {
+			a.stopCommands()
+			return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+		}
+		a.subs = append(a.subs, sub)
+	}
+
+	logging.Info("Listening for commands", "subjects", strings.Join(patterns, ","), "signed", len(a.config().Agent.Signing.CommandKeys) > 0)
+	return nil
+}
+
+// stopCommands removes the command subscriptions
+func (a *Agent) stopCommands() {
+	for _, sub := range a.subs {
+		if err := sub.Unsubscribe(); err != nil && err != natsgo.ErrConnectionClosed {
+			logging.Warn("Failed to unsubscribe", "subject", sub.Subject, "error", err)
+		}
+	}
+	a.subs = nil
+}
+
+// handleCommand runs the command named by the last subject token and replies
+// with a CommandResponse
+func (a *Agent) handleCommand(msg *natsgo.Msg) {
+	command := msg.Subject[strings.LastIndex(msg.Subject, ".")+1:]
+
+	var req CommandRequest
+	if len(msg.Data) > 0 {
+		if err := json.Unmarshal(msg.Data, &req); err != nil {
+			a.replyCommand(msg, CommandResponse{Command: command, Error: "invalid request payload: " + err.Error()})
+			return
+		}
+	}
+	actor, err := a.authorizeCommand(msg, req)
+	if err != nil {
+		a.audit("nats", actor, command, "", err)
+		a.replyCommand(msg, CommandResponse{Command: command, Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(a.ctx, commandTimeout)
+	defer cancel()
+
+	result, action, target, err := a.runCommand(ctx, command, req)
+	if action != "" {
+		a.audit("nats", actor, action, target, err)
+	}
+
+	resp := CommandResponse{Command: command, OK: err == nil, Result: result}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	a.replyCommand(msg, resp)
+}
+
+// authorizeCommand returns the actor to audit for a command. With
+// Agent.Signing.CommandKeys set, a command must be signed by one of the keys
+// and issued within commandMaxAge of now; the actor is the operator the key
+// belongs to. Without it, anyone allowed to publish on the command subjects
+// may run commands, and NATS does not tell subscribers who published, so the
+// actor named in the request is recorded as unverified.
+func (a *Agent) authorizeCommand(msg *natsgo.Msg, req CommandRequest) (string, error) {
+	claimed := req.Actor
+	if claimed == "" {
+		claimed = "nats"
+	}
+	unverified := "unverified:" + claimed
+
+	keys := a.config().Agent.Signing.CommandKeys
+	if len(keys) == 0 {
+		return unverified, nil
+	}
+
+	publicKey, err := signing.Verify(msg)
+	if err != nil {
+		return unverified, fmt.Errorf("unauthorized: %w", err)
+	}
+	operator := ""
+	for name, key := range keys {
+		if key == publicKey {
+			operator = name
+			break
+		}
+	}
+	if operator == "" {
+		return unverified, fmt.Errorf("unauthorized: %s is not a command key", publicKey)
+	}
+	if req.IssuedAt == nil {
+		return operator, errors.New("unauthorized: signed commands must set issued_at")
+	}
+	if age := time.Since(*req.IssuedAt); age > commandMaxAge || age < -commandMaxAge {
+		return operator, fmt.Errorf("unauthorized: issued_at is %s away from the agent clock (limit %s)", age.Round(time.Second), commandMaxAge)
+	}
+	return operator, nil
+}
+
+// runCommand dispatches a command. action is the audited action name, or
+// empty for read-only commands.
+func (a *Agent) runCommand(ctx context.Context, command string, req CommandRequest) (result interface{}, action, target string, err error) {
+	switch command {
+	case CommandStatus:
+		return a.Status(), "", "", nil
+	case CommandCheckNow:
+		result, err = a.CheckNow(ctx, req.Service)
+		return result, ActionCheck, req.Service, err
+	case CommandReload:
+		if err := a.ReloadConfig(); err != nil {
+			return nil, ActionReload, "", err
+		}
+		return map[string]string{"config_hash": a.config().Hash()}, ActionReload, "", nil
+	case CommandPause:
+		return nil, ActionPause, req.Service, requireField("service", req.Service, a.Pause)
+	case CommandResume:
+		return nil, ActionResume, req.Service, requireField("service", req.Service, a.Resume)
+	case CommandReport:
+		return nil, ActionReport, "", a.ForceReport()
+	case CommandSetLogLevel:
+		return nil, ActionSetLogLevel, req.Level, requireField("level", req.Level, a.SetLogLevel)
+	default:
+		return nil, "", "", inputErrorf("unknown command %q", command)
+	}
+}
+
+func requireField(name, value string, fn func(string) error) error {
+	if value == "" {
+		return inputErrorf("missing %s", name)
+	}
+	return fn(value)
+}
+
+func (a *Agent) replyCommand(msg *natsgo.Msg, resp CommandResponse) {
+	if msg.Reply == "" {
+		// Fire-and-forget publish; nothing to answer
+		return
+	}
+
+	resp.AgentID = a.config().Agent.AgentID
+	data, err := json.Marshal(resp)
+	if err != nil {
+		logging.Error("Failed to marshal command response", "command", resp.Command, "error", err)
+		return
+	}
+	if err := nats.Publish(msg.Reply, data); err != nil {
+		logging.Warn("Failed to reply to command", "command", resp.Command, "error", err)
+	}
+}
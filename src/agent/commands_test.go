@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/signing"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+func TestAuthorizeCommand(t *testing.T) {
+	operator, stranger := newTestSigner(t), newTestSigner(t)
+	subject := "agent.cmd.a1.reload"
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		issued := now.Add(d)
+		return &issued
+	}
+
+	tests := []struct {
+		name     string
+		signer   *signing.Signer
+		issuedAt *time.Time
+		tamper   bool
+		actor    string
+		err      string
+	}{
+		{"signed and fresh", operator, at(0), false, "ops", ""},
+		{"slightly ahead of the agent clock", operator, at(time.Minute), false, "ops", ""},
+		{"expired issued_at", operator, at(-commandMaxAge - time.Minute), false, "ops", "issued_at"},
+		{"issued_at too far ahead", operator, at(commandMaxAge + time.Minute), false, "ops", "issued_at"},
+		{"no issued_at", operator, nil, false, "ops", "must set issued_at"},
+		{"unsigned", nil, at(0), false, "unverified:alice", "not signed"},
+		{"unknown key", stranger, at(0), false, "unverified:alice", "is not a command key"},
+		{"tampered payload", operator, at(0), true, "unverified:alice", "invalid signature"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Agent.Signing.CommandKeys = map[string]string{"ops": operator.PublicKey()}
+			a := &Agent{configs: config.NewStore(cfg)}
+
+			req := CommandRequest{Actor: "alice", IssuedAt: tt.issuedAt}
+			data, _ := json.Marshal(req)
+			msg := &natsgo.Msg{Subject: subject, Data: data, Header: natsgo.Header{}}
+			if tt.signer != nil {
+				if err := tt.signer.Sign(subject, data, msg.Header); err != nil {
+					t.Fatalf("Sign: %v", err)
+				}
+			}
+			if tt.tamper {
+				// Moving issued_at after signing, to replay an old command
+				msg.Data, _ = json.Marshal(CommandRequest{Actor: "alice", IssuedAt: at(time.Second)})
+			}
+
+			actor, err := a.authorizeCommand(msg, req)
+			if actor != tt.actor {
+				t.Errorf("actor %q, want %q", actor, tt.actor)
+			}
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("authorizeCommand: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("authorizeCommand: got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+
+	// Without command keys anyone may run commands, recorded as unverified
+	a := &Agent{configs: config.NewStore(&config.Config{})}
+	if actor, err := a.authorizeCommand(&natsgo.Msg{Subject: subject}, CommandRequest{Actor: "alice"}); err != nil || actor != "unverified:alice" {
+		t.Errorf("without command keys: actor %q, error %v", actor, err)
+	}
+}
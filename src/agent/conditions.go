@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+)
+
+// registerConditions wires the agent's real state into /ready and /health
+func (a *Agent) registerConditions() {
+	a.health.AddReadinessCheck("config", a.configCondition)
+	a.health.AddReadinessCheck("nats", natsCondition)
+	a.health.AddReadinessCheck("first_check_cycle", a.firstCycleCondition)
+	a.health.AddHealthCheck("report_publish", a.reportPublishCondition)
+}
+
+// configCondition fails if the most recent configuration load failed
+func (a *Agent) configCondition() error {
+	a.stateMu.RLock()
+	defer a.stateMu.RUnlock()
+	if a.configErr != nil {
+		return fmt.Errorf("configuration failed to load: %w", a.configErr)
+	}
+	return nil
+}
+
+// setConfigError records the result of the most recent configuration load
+func (a *Agent) setConfigError(err error) {
+	a.stateMu.Lock()
+	defer a.stateMu.Unlock()
+	a.configErr = err
+}
+
+func natsCondition() error {
+	if !nats.IsConnected() {
+		return errors.New("not connected to NATS")
+	}
+	return nil
+}
+
+// firstCycleCondition fails until every service has been checked once
+func (a *Agent) firstCycleCondition() error {
+	if !a.firstCycleDone.Load() {
+		return errors.New("first check cycle has not completed")
+	}
+	return nil
+}
+
+// reportPublishCondition fails once report publishing has been failing for
+// longer than Agent.ReportFailureThreshold
+func (a *Agent) reportPublishCondition() error {
+	since := a.reporter.FailingSince()
+	if since.IsZero() {
+		return nil
+	}
+
+	threshold := time.Duration(a.config().Agent.ReportFailureThreshold) * time.Second
+	if failing := time.Since(since); failing > threshold {
+		return fmt.Errorf("report publishing failing for %s (threshold %s)", failing.Round(time.Second), threshold)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/consensus"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+// Event types published when the consensus about a service changes
+const (
+	EventServiceOffline = "service_offline"
+	EventServiceOnline  = "service_online"
+)
+
+// startConsensus subscribes to other agents' observations when consensus
+// mode is enabled
+func (a *Agent) startConsensus(ctx context.Context) error {
+	if a.consensus == nil {
+		return nil
+	}
+
+	sub, err := nats.Subscribe(a.subjects.AllObservations(), a.handleObservation)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to observations: %w", err)
+	}
+	a.subs = append(a.subs, sub)
+
+	cfg := a.config().Agent.Consensus
+	logging.Info("Consensus mode enabled", "quorum", cfg.Quorum, "windowSeconds", cfg.Window, "distinctRegions", cfg.DistinctRegions, "region", cfg.Region)
+	return nil
+}
+
+// handleObservation records another agent's observation of a service this
+// agent also monitors
+func (a *Agent) handleObservation(msg *natsgo.Msg) {
+	var obs consensus.Observation
+	if err := json.Unmarshal(msg.Data, &obs); err != nil {
+		logging.Debug("Ignoring malformed observation", "subject", msg.Subject, "error", err)
+		return
+	}
+	if obs.AgentID == "" || obs.AgentID == a.config().Agent.AgentID {
+		return
+	}
+	if _, err := a.findService(obs.Service); err != nil {
+		return
+	}
+	if !a.sentBy(obs.AgentID, msg) || !a.verifyPeer(obs.AgentID, msg, requireSignedVotes(a.config())) {
+		return
+	}
+
+	a.consensus.Observe(obs, time.Now())
+	result, changed := a.evaluateConsensus(obs.Service)
+	if !changed {
+		return
+	}
+
+	// Apply the new consensus to the last check of the service
+	if current, ok := a.reporter.ServiceStatus(obs.Service); ok {
+		updated := withConsensus(current, result.State)
+		a.reporter.ReportServiceStatus(obs.Service, updated)
+		a.recordState(updated)
+	}
+}
+
+// applyConsensus shares a local check result with the other agents and
+// returns the status to report, which the caller reports and records. A
+// local failure is reported as degraded until enough agents agree the
+// service is down.
+func (a *Agent) applyConsensus(status reporter.ServiceStatus) reporter.ServiceStatus {
+	if a.consensus == nil {
+		return status
+	}
+
+	obs := consensus.Observation{
+		AgentID:    a.config().Agent.AgentID,
+		Region:     a.config().Agent.Consensus.Region,
+		Service:    status.Name,
+		Status:     consensus.StateUp,
+		Error:      status.Error,
+		ObservedAt: status.LastCheck,
+	}
+	if status.Status == "down" {
+		obs.Status = consensus.StateDown
+	}
+
+	if data, err := json.Marshal(obs); err == nil {
+		subject := a.subjects.Observation(a.config().Agent.AgentID)
+		if err := nats.Publish(subject, data); err != nil {
+			logging.Warn("Failed to publish observation", "service", status.Name, "error", err)
+		}
+	}
+
+	a.consensus.Observe(obs, time.Now())
+	result, _ := a.evaluateConsensus(status.Name)
+	return withConsensus(status, result.State)
+}
+
+// evaluateConsensus re-evaluates a service and publishes an event with the
+// result and votes whenever the consensus changes
+func (a *Agent) evaluateConsensus(service string) (consensus.Result, bool) {
+	result, changed := a.consensus.Evaluate(service, time.Now())
+	if !changed {
+		return result, false
+	}
+
+	eventType := EventServiceOnline
+	if result.State == consensus.StateDown {
+		eventType = EventServiceOffline
+	}
+	logging.Warn("Service consensus changed", "service", service, "state", result.State, "downVotes", result.DownVotes, "quorum", result.Quorum)
+	a.publishEvent(eventType, result)
+	return result, true
+}
+
+// withConsensus adjusts a local status to the consensus state
+func withConsensus(status reporter.ServiceStatus, state string) reporter.ServiceStatus {
+	status.Consensus = state
+	switch {
+	case state == consensus.StateDown:
+		status.Status = "down"
+	case status.Error != "":
+		status.Status = "degraded"
+	default:
+		status.Status = "up"
+	}
+	return status
+}
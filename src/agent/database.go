@@ -0,0 +1,96 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/database"
+	"github.com/ibp-network/ibp-geodns-agent/src/incidents"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+)
+
+// resultDropLogInterval limits warnings about check results dropped by a
+// full MySQL queue, which otherwise repeat on every check while the database
+// is down
+const resultDropLogInterval = time.Minute
+
+// startDatabase starts writing check results, state changes and incidents
+// to MySQL when Mysql is enabled
+func (a *Agent) startDatabase() error {
+	cfg := a.config().Mysql
+	if !cfg.Enabled {
+		return nil
+	}
+
+	sink, err := database.Open(cfg, a.config().Agent.AgentID)
+	if err != nil {
+		return err
+	}
+	a.database = sink
+	logging.Info("Writing check results to MySQL", "host", cfg.Host, "port", cfg.Port, "db", cfg.DB, "batchSize", cfg.BatchSize, "queueSize", cfg.QueueSize)
+	return nil
+}
+
+// stopDatabase writes the records still queued and closes the connection
+func (a *Agent) stopDatabase(ctx context.Context) {
+	if a.database == nil {
+		return
+	}
+	if err := a.database.Close(ctx); err != nil {
+		logging.Warn("Failed to flush check results to MySQL", "error", err)
+	}
+}
+
+// recordState tracks the reported status of a service, opening and
+// resolving incidents, and records and posts every change
+func (a *Agent) recordState(status reporter.ServiceStatus) {
+	// A consensus change re-reports the last check, so stamp the change with
+	// the time it was seen rather than the time of the check
+	change, ok := a.incidents.Observe(status.Name, status.Status, status.Error, time.Now())
+	if !ok {
+		return
+	}
+	a.recordChange(change)
+}
+
+// recordChange writes a state change to MySQL and posts it to Matrix
+func (a *Agent) recordChange(change incidents.Change) {
+	if a.database != nil && !a.database.RecordChange(change) {
+		logging.Warn("MySQL queue full; dropping state change", "service", change.Service)
+	}
+	a.notifyChange(change)
+}
+
+// recordDatabase queues a check result for MySQL
+func (a *Agent) recordDatabase(status reporter.ServiceStatus) {
+	if a.database == nil {
+		return
+	}
+	queued := a.database.RecordResult(database.Result{
+		Service:   status.Name,
+		Status:    status.Status,
+		Consensus: status.Consensus,
+		LatencyMs: status.LatencyMs,
+		Error:     status.Error,
+		CheckedAt: status.LastCheck,
+	})
+	if queued {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := a.resultDropLog.Load()
+	if now-last >= int64(resultDropLogInterval) && a.resultDropLog.CompareAndSwap(last, now) {
+		logging.Warn("MySQL queue full; dropping check results", "service", status.Name, "dropped", a.database.Stats().Dropped)
+	}
+}
+
+// databaseStats returns the state of the MySQL sink, or nil if it is off
+func (a *Agent) databaseStats() *database.Stats {
+	if a.database == nil {
+		return nil
+	}
+	stats := a.database.Stats()
+	return &stats
+}
@@ -0,0 +1,219 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/history"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// historyFile is the name of the history database under System.WorkDir
+const historyFile = "history.db"
+
+// historyPruneInterval is how often expired history is deleted
+const historyPruneInterval = time.Hour
+
+// errHistoryDisabled is returned by history queries when Agent.History is off
+var errHistoryDisabled = errors.New("check history is disabled")
+
+// HistoryQuery selects the check history of one service. From defaults to
+// an hour before To for raw results, a day for 1m and 30 days for 1h
+// rollups; To defaults to now.
+type HistoryQuery struct {
+	Service    string    `json:"service"`
+	Resolution string    `json:"resolution,omitempty"` // raw, 1m (default) or 1h
+	From       time.Time `json:"from,omitempty"`
+	To         time.Time `json:"to,omitempty"`
+}
+
+// History is the answer to a HistoryQuery
+type History struct {
+	Service    string           `json:"service"`
+	Resolution string           `json:"resolution"`
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Results    []history.Result `json:"results,omitempty"`
+	Rollups    []history.Rollup `json:"rollups,omitempty"`
+	Truncated  bool             `json:"truncated,omitempty"` // more than history.MaxPoints matched
+}
+
+// startHistory opens the check history under System.WorkDir and prunes it
+// periodically
+func (a *Agent) startHistory(ctx context.Context) error {
+	if !a.config().Agent.History.Enabled {
+		return nil
+	}
+
+	if err := os.MkdirAll(a.config().System.WorkDir, 0o750); err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	path := filepath.Join(a.config().System.WorkDir, historyFile)
+	store, err := history.Open(path)
+	if err != nil {
+		return err
+	}
+	a.history = store
+
+	go a.historyPruneLoop(ctx)
+	logging.Info("Recording check history", "path", path)
+	return nil
+}
+
+// stopHistory closes the check history
+func (a *Agent) stopHistory() {
+	if a.history == nil {
+		return
+	}
+	if err := a.history.Close(); err != nil {
+		logging.Warn("Failed to close check history", "error", err)
+	}
+}
+
+// historyPruneLoop deletes expired history at startup and then hourly
+func (a *Agent) historyPruneLoop(ctx context.Context) {
+	ticker := time.NewTicker(historyPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		a.pruneHistory()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *Agent) pruneHistory() {
+	cfg := a.config().Agent.History
+	day := 24 * time.Hour
+	removed, err := a.history.Prune(time.Now(), history.Retention{
+		Raw:    time.Duration(cfg.RawRetention) * day,
+		Minute: time.Duration(cfg.MinuteRetention) * day,
+		Hour:   time.Duration(cfg.HourRetention) * day,
+	})
+	if err != nil {
+		logging.Warn("Failed to prune check history", "error", err)
+		return
+	}
+	logging.Debug("Pruned check history", "removed", removed)
+}
+
+// recordHistory stores a reported check result
+func (a *Agent) recordHistory(status reporter.ServiceStatus) {
+	if a.history == nil {
+		return
+	}
+	err := a.history.Record(status.Name, history.Result{
+		Time:      status.LastCheck,
+		Status:    status.Status,
+		LatencyMs: status.LatencyMs,
+		Error:     status.Error,
+	})
+	if err != nil {
+		logging.Warn("Failed to record check history", "service", status.Name, "error", err)
+	}
+}
+
+// History returns stored results or rollups of a service
+func (a *Agent) History(q HistoryQuery) (History, error) {
+	if a.history == nil {
+		return History{}, errHistoryDisabled
+	}
+	if q.Service == "" {
+		return History{}, fmt.Errorf("missing service")
+	}
+
+	res := history.Resolution(q.Resolution)
+	span := 24 * time.Hour
+	switch res {
+	case "":
+		res = history.Minute
+	case history.Raw:
+		span = time.Hour
+	case history.Minute:
+	case history.Hour:
+		span = 30 * 24 * time.Hour
+	default:
+		return History{}, fmt.Errorf("%w %q", history.ErrUnknownResolution, q.Resolution)
+	}
+	if q.To.IsZero() {
+		q.To = time.Now()
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-span)
+	}
+
+	out := History{Service: q.Service, Resolution: string(res), From: q.From.UTC(), To: q.To.UTC()}
+	var err error
+	if res == history.Raw {
+		out.Results, out.Truncated, err = a.history.Results(q.Service, q.From, q.To)
+	} else {
+		out.Rollups, out.Truncated, err = a.history.Rollups(q.Service, res, q.From, q.To)
+	}
+	return out, err
+}
+
+// historyHandler serves GET /history?service=NAME&resolution=1m&from=RFC3339&to=RFC3339
+func (a *Agent) historyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	params := r.URL.Query()
+	q := HistoryQuery{Service: params.Get("service"), Resolution: params.Get("resolution")}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		if value := params.Get(p.name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid %s: %v", p.name, err)})
+				return
+			}
+			*p.t = parsed
+		}
+	}
+
+	h, err := a.History(q)
+	switch {
+	case errors.Is(err, errHistoryDisabled):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, h)
+	}
+}
+
+// handleServiceHistory answers the history service endpoint with a
+// HistoryQuery payload
+func (a *Agent) handleServiceHistory(req micro.Request) {
+	var q HistoryQuery
+	if err := json.Unmarshal(req.Data(), &q); err != nil {
+		_ = req.Error("400", "invalid request payload: "+err.Error(), nil)
+		return
+	}
+
+	h, err := a.History(q)
+	switch {
+	case errors.Is(err, errHistoryDisabled):
+		_ = req.Error("404", err.Error(), nil)
+	case err != nil:
+		_ = req.Error("400", err.Error(), nil)
+	default:
+		respondJSON(req, h)
+	}
+}
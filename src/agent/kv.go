@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// kvInitialTimeout bounds how long startup waits for the current KV values
+const kvInitialTimeout = 10 * time.Second
+
+// kvKeyInvalid matches characters JetStream KV keys cannot contain
+var kvKeyInvalid = regexp.MustCompile(`[^-/_=.a-zA-Z0-9]`)
+
+// kvKey returns the KV key holding the overrides of an agent
+func kvKey(agentID string) string {
+	return kvKeyInvalid.ReplaceAllString(agentID, "_")
+}
+
+// startConfigKV applies Agent overrides from the configured KV bucket and
+// keeps watching it, applying every change through the reload path. It
+// returns once the current values are applied or kvInitialTimeout passes.
+func (a *Agent) startConfigKV(ctx context.Context) error {
+	kvCfg := a.config().System.ConfigKV
+	if !kvCfg.Enabled() {
+		return nil
+	}
+
+	kv, err := nats.KeyValue(ctx, kvCfg.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to open config bucket %s: %w", kvCfg.Bucket, err)
+	}
+
+	keys := []string{kvCfg.DefaultKey}
+	if key := kvKey(a.config().Agent.AgentID); key != kvCfg.DefaultKey {
+		keys = append(keys, key)
+	}
+	// WatchFiltered rewrites the slice it is given into subjects
+	watcher, err := kv.WatchFiltered(ctx, append([]string(nil), keys...))
+	if err != nil {
+		return fmt.Errorf("failed to watch config bucket %s: %w", kvCfg.Bucket, err)
+	}
+
+	initial := make(chan struct{})
+	go a.watchConfigKV(ctx, watcher, kvCfg.Bucket, keys, initial)
+
+	logging.Info("Watching config bucket", "bucket", kvCfg.Bucket, "keys", keys)
+	select {
+	case <-initial:
+	case <-time.After(kvInitialTimeout):
+		logging.Warn("Timed out waiting for config bucket; continuing with the file configuration", "bucket", kvCfg.Bucket)
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// watchConfigKV tracks the watched keys and reloads the configuration
+// whenever one of them changes
+func (a *Agent) watchConfigKV(ctx context.Context, watcher jetstream.KeyWatcher, bucket string, keys []string, initial chan struct{}) {
+	defer watcher.Stop()
+
+	values := make(map[string][]byte)
+	loaded := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case entry, ok := <-watcher.Updates():
+			if !ok {
+				return
+			}
+			if entry == nil {
+				// Every current value has been delivered
+				loaded = true
+				if len(values) > 0 {
+					a.applyConfigKV(bucket, keys, values, "")
+				}
+				close(initial)
+				continue
+			}
+
+			if entry.Operation() == jetstream.KeyValuePut {
+				values[entry.Key()] = entry.Value()
+			} else {
+				delete(values, entry.Key())
+			}
+			if loaded {
+				logging.Info("Config bucket changed", "bucket", bucket, "key", entry.Key(), "revision", entry.Revision(), "operation", entry.Operation().String())
+				a.applyConfigKV(bucket, keys, values, entry.Key())
+			}
+		}
+	}
+}
+
+// applyConfigKV reloads the configuration with the watched keys as overlays,
+// the shared default key first
+func (a *Agent) applyConfigKV(bucket string, keys []string, values map[string][]byte, changedKey string) {
+	var overlays []config.Overlay
+	for _, key := range keys {
+		if data, ok := values[key]; ok {
+			overlays = append(overlays, config.Overlay{Source: "kv:" + bucket + "/" + key, Data: data})
+		}
+	}
+
+	a.reloadMu.Lock()
+	previous := a.config()
+	err := a.applyReload(previous, a.configs.ReloadWithOverlays(overlays))
+	a.reloadMu.Unlock()
+
+	a.audit("kv", bucket, ActionReload, changedKey, err)
+}
@@ -0,0 +1,232 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/incidents"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/matrix"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+)
+
+// matrixSessionFile is the name of the Matrix session file under
+// System.WorkDir
+const matrixSessionFile = "matrix-session.json"
+
+// startNotifications posts status changes to the Matrix room when Matrix is
+// enabled
+func (a *Agent) startNotifications(ctx context.Context) error {
+	cfg := a.config().Matrix
+	if !cfg.Enabled {
+		return nil
+	}
+
+	if err := os.MkdirAll(a.config().System.WorkDir, 0o750); err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	client := matrix.NewClient(cfg.HomeServerURL, cfg.Username, cfg.Password, filepath.Join(a.config().System.WorkDir, matrixSessionFile))
+	a.notifier = matrix.NewNotifier(client, matrix.Options{
+		Room:        cfg.RoomID,
+		RateLimit:   cfg.RateLimit,
+		DedupWindow: time.Duration(cfg.DedupWindow) * time.Second,
+	})
+	a.flaps = newFlapTracker(cfg.FlapThreshold, time.Duration(cfg.FlapWindow)*time.Second)
+	a.notifier.Start(ctx)
+
+	logging.Info("Posting notifications to Matrix", "homeServer", cfg.HomeServerURL, "room", cfg.RoomID, "rateLimit", cfg.RateLimit)
+	return nil
+}
+
+// notifyChange posts a service going down or recovering, threaded under
+// its incident. While a service flaps only the start and end of flapping
+// are posted.
+func (a *Agent) notifyChange(change incidents.Change) {
+	if a.notifier == nil {
+		return
+	}
+	if change.To == incidents.StatusRemoved {
+		a.notifyRemoved(change)
+		return
+	}
+
+	started, since, flapping := a.flaps.change(change.Service, change.At)
+	if started {
+		detail := fmt.Sprintf("status changed %d times within %s; further changes are not posted until it is stable", a.flaps.threshold, a.flaps.window)
+		a.notify(matrix.Notification{Thread: flapThread(change.Service, since)}, "FLAPPING", change.Service, detail)
+	}
+	if flapping {
+		return
+	}
+
+	inc := change.Incident
+	switch {
+	case inc == nil:
+	case inc.ResolvedAt != nil:
+		detail := fmt.Sprintf("%s again after %s", change.To, inc.ResolvedAt.Sub(inc.StartedAt).Round(time.Second))
+		a.notify(matrix.Notification{Key: "recovered:" + inc.ID, Thread: inc.ID, EndThread: true}, "RECOVERED", change.Service, detail)
+	default:
+		a.notifyDown(*inc, inc.Error)
+	}
+}
+
+// notifyDown posts an open incident, starting its thread
+func (a *Agent) notifyDown(inc incidents.Incident, detail string) {
+	if detail == "" {
+		detail = "down"
+	}
+	a.notify(matrix.Notification{Key: "down:" + inc.ID, Thread: inc.ID}, "DOWN", inc.Service, detail)
+}
+
+// notifyRemoved ends the thread of a service removed from the configuration
+// while down. Incidents opened while flapping have no thread of their own, so
+// the flapping thread is ended instead.
+func (a *Agent) notifyRemoved(change incidents.Change) {
+	const detail = "removed from the configuration while down"
+	if since, ok := a.flaps.forget(change.Service); ok {
+		a.notify(matrix.Notification{Thread: flapThread(change.Service, since), EndThread: true}, "REMOVED", change.Service, detail)
+		return
+	}
+	if inc := change.Incident; inc != nil {
+		a.notify(matrix.Notification{Key: "recovered:" + inc.ID, Thread: inc.ID, EndThread: true}, "REMOVED", change.Service, detail)
+	}
+}
+
+// notifyCheck posts the end of flapping and certificates close to expiry
+func (a *Agent) notifyCheck(status reporter.ServiceStatus) {
+	if a.notifier == nil {
+		return
+	}
+
+	if since, ok := a.flaps.settled(status.Name, time.Now()); ok {
+		detail := fmt.Sprintf("no status change for %s, now %s", a.flaps.window, status.Status)
+		a.notify(matrix.Notification{Thread: flapThread(status.Name, since), EndThread: true}, "STABLE", status.Name, detail)
+		// The DOWN of an incident opened while flapping was not posted;
+		// post it now so its RECOVERED has a thread to reply in
+		if inc, ok := a.incidents.Open(status.Name); ok {
+			detail := "down since " + inc.StartedAt.UTC().Format("2006-01-02 15:04 MST")
+			if inc.Error != "" {
+				detail += ": " + inc.Error
+			}
+			a.notifyDown(inc, detail)
+		}
+	}
+
+	if status.CertExpiresAt == nil {
+		return
+	}
+	expiry := status.CertExpiresAt.UTC()
+	left := time.Until(expiry)
+	if left >= time.Duration(a.config().Matrix.CertExpiryDays)*24*time.Hour {
+		return
+	}
+	detail := fmt.Sprintf("certificate expires in %d days (%s)", int(left.Hours()/24), expiry.Format("2006-01-02 15:04 MST"))
+	if left <= 0 {
+		detail = "certificate expired at " + expiry.Format("2006-01-02 15:04 MST")
+	}
+	key := fmt.Sprintf("cert:%s:%d", status.Name, expiry.Unix())
+	a.notify(matrix.Notification{Key: key}, "CERTIFICATE", status.Name, detail)
+}
+
+// notify fills in the message for a service on this agent and queues it
+func (a *Agent) notify(note matrix.Notification, label, service, detail string) {
+	agentID := a.config().Agent.AgentID
+	note.Text = fmt.Sprintf("[%s] %s on %s: %s", label, service, agentID, detail)
+	note.HTML = fmt.Sprintf("<b>%s</b> <code>%s</code> on %s: %s", label, html.EscapeString(service), html.EscapeString(agentID), html.EscapeString(detail))
+	a.notifier.Notify(note)
+}
+
+// notificationStats returns the state of the Matrix notifier, or nil if it
+// is off
+func (a *Agent) notificationStats() *matrix.Stats {
+	if a.notifier == nil {
+		return nil
+	}
+	stats := a.notifier.Stats()
+	return &stats
+}
+
+// flapThread identifies the thread of one flapping period
+func flapThread(service string, since time.Time) string {
+	return fmt.Sprintf("flap:%s:%d", service, since.UnixNano())
+}
+
+// flapTracker detects services whose status keeps changing
+type flapTracker struct {
+	threshold int
+	window    time.Duration
+
+	mu       sync.Mutex
+	services map[string]*flapState
+}
+
+type flapState struct {
+	changes []time.Time // within the window
+	since   time.Time   // start of flapping; zero if not flapping
+}
+
+func newFlapTracker(threshold int, window time.Duration) *flapTracker {
+	return &flapTracker{threshold: threshold, window: window, services: make(map[string]*flapState)}
+}
+
+// change records a status change. It returns whether the service started
+// flapping with this change, when flapping started and whether it is
+// flapping.
+func (f *flapTracker) change(service string, at time.Time) (started bool, since time.Time, flapping bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state, ok := f.services[service]
+	if !ok {
+		state = &flapState{}
+		f.services[service] = state
+	}
+	recent := state.changes[:0]
+	for _, t := range state.changes {
+		if at.Sub(t) < f.window {
+			recent = append(recent, t)
+		}
+	}
+	state.changes = append(recent, at)
+
+	if state.since.IsZero() && len(state.changes) >= f.threshold {
+		state.since = at
+		return true, at, true
+	}
+	return false, state.since, !state.since.IsZero()
+}
+
+// forget drops the state of a service and returns when it started flapping,
+// if it was
+func (f *flapTracker) forget(service string) (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state, ok := f.services[service]
+	delete(f.services, service)
+	if !ok || state.since.IsZero() {
+		return time.Time{}, false
+	}
+	return state.since, true
+}
+
+// settled ends flapping once a service has not changed status for the
+// window and returns when flapping started
+func (f *flapTracker) settled(service string, now time.Time) (time.Time, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	state, ok := f.services[service]
+	if !ok || state.since.IsZero() || now.Sub(state.changes[len(state.changes)-1]) < f.window {
+		return time.Time{}, false
+	}
+	since := state.since
+	state.since = time.Time{}
+	state.changes = nil
+	return since, true
+}
@@ -0,0 +1,113 @@
+package agent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFlapTrackerChange(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type step struct {
+		at       time.Duration
+		started  bool
+		flapping bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"below threshold", []step{
+			{0, false, false},
+			{time.Minute, false, false},
+		}},
+		{"threshold reached within the window", []step{
+			{0, false, false},
+			{time.Minute, false, false},
+			{2 * time.Minute, true, true},
+			{3 * time.Minute, false, true},
+		}},
+		{"changes outside the window do not count", []step{
+			{0, false, false},
+			{6 * time.Minute, false, false},
+			{12 * time.Minute, false, false},
+			{13 * time.Minute, false, false},
+			{14 * time.Minute, true, true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFlapTracker(3, 5*time.Minute)
+			var flapSince time.Time
+			for i, s := range tt.steps {
+				at := start.Add(s.at)
+				started, since, flapping := f.change("rpc", at)
+				if started != s.started || flapping != s.flapping {
+					t.Fatalf("step %d: started %v flapping %v, want %v %v", i, started, flapping, s.started, s.flapping)
+				}
+				if started {
+					flapSince = at
+				}
+				if flapping && !since.Equal(flapSince) {
+					t.Errorf("step %d: flapping since %s, want %s", i, since, flapSince)
+				}
+			}
+		})
+	}
+}
+
+func TestFlapTrackerSettled(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := 5 * time.Minute
+	f := newFlapTracker(2, window)
+
+	if _, ok := f.settled("rpc", start); ok {
+		t.Error("unknown service settled")
+	}
+	f.change("rpc", start)
+	f.change("rpc", start.Add(time.Minute))
+	f.change("other", start)
+
+	last := start.Add(time.Minute)
+	if _, ok := f.settled("rpc", last.Add(window-time.Second)); ok {
+		t.Error("settled before a quiet window")
+	}
+	if _, ok := f.settled("other", last.Add(window)); ok {
+		t.Error("service that never flapped settled")
+	}
+	since, ok := f.settled("rpc", last.Add(window))
+	if !ok || !since.Equal(last) {
+		t.Errorf("settled = %s %v, want flapping since %s", since, ok, last)
+	}
+	if _, ok := f.settled("rpc", last.Add(2*window)); ok {
+		t.Error("settled twice")
+	}
+
+	// Flapping starts over from the threshold after settling
+	if started, _, _ := f.change("rpc", last.Add(2*window)); started {
+		t.Error("first change after settling started flapping")
+	}
+}
+
+func TestFlapTrackerForget(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	f := newFlapTracker(2, 5*time.Minute)
+
+	f.change("rpc", start)
+	f.change("rpc", start.Add(time.Second))
+	f.change("quiet", start)
+
+	if since, ok := f.forget("rpc"); !ok || !since.Equal(start.Add(time.Second)) {
+		t.Errorf("forget = %s %v, want flapping since %s", since, ok, start.Add(time.Second))
+	}
+	if _, ok := f.forget("quiet"); ok {
+		t.Error("forget reported a service that was not flapping")
+	}
+	if _, ok := f.forget("rpc"); ok {
+		t.Error("forgotten service still flapping")
+	}
+	if started, _, _ := f.change("rpc", start.Add(2*time.Second)); started {
+		t.Error("forgotten service kept its earlier changes")
+	}
+}
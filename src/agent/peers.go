@@ -0,0 +1,98 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/codec"
+	"github.com/ibp-network/ibp-geodns-agent/src/fleet"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+// Event types published for peer agents
+const (
+	EventPeerLost      = "peer_lost"
+	EventPeerRecovered = "peer_recovered"
+)
+
+// startPeers subscribes to every agent's reports and starts the loop that
+// flags peers which stopped reporting
+func (a *Agent) startPeers(ctx context.Context) error {
+	sub, err := nats.Subscribe(a.subjects.AllReports(), a.handlePeerReport)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to peer reports: %w", err)
+	}
+	a.subs = append(a.subs, sub)
+
+	go a.peerSweepLoop(ctx)
+	return nil
+}
+
+// handlePeerReport records a report published by another agent
+func (a *Agent) handlePeerReport(msg *natsgo.Msg) {
+	var report reporter.Report
+	if err := codec.Decode(msg, &report); err != nil {
+		logging.Debug("Ignoring malformed peer report", "subject", msg.Subject, "error", err)
+		return
+	}
+	if report.AgentID == "" || report.AgentID == a.config().Agent.AgentID {
+		return
+	}
+	if !a.sentBy(report.AgentID, msg) || !a.verifyPeer(report.AgentID, msg, a.config().Agent.Signing.RequirePeers) {
+		return
+	}
+
+	// Receive time rather than report.Timestamp, so peer clock skew cannot
+	// hide a dead agent
+	services := len(report.Services)
+	if known, ok := a.peers.Peer(report.AgentID); ok && report.Delta {
+		// A delta only lists the services that changed
+		services = known.Services
+	}
+	peer, recovered := a.peers.Observe(report.AgentID, report.Version, report.Status, services, time.Now())
+	if recovered {
+		logging.Info("Peer agent recovered", "peer", peer.AgentID)
+		a.publishEvent(EventPeerRecovered, peer)
+	}
+	if report.Status == reporter.StatusOffline {
+		logging.Info("Peer agent shut down", "peer", peer.AgentID)
+	}
+}
+
+// peerSweepLoop periodically flags peers that have gone silent
+func (a *Agent) peerSweepLoop(ctx context.Context) {
+	interval := a.peers.Threshold() / 3
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, peer := range a.peers.Sweep(now) {
+				logging.Warn("Peer agent lost", "peer", peer.AgentID, "lastSeen", peer.LastSeen.Format(time.RFC3339), "threshold", a.peers.Threshold())
+				a.publishEvent(EventPeerLost, peer)
+			}
+		}
+	}
+}
+
+// publishEvent publishes an agent event, logging failures
+func (a *Agent) publishEvent(eventType string, data interface{}) {
+	if err := a.reporter.PublishEvent(eventType, data); err != nil {
+		logging.Warn("Failed to publish event", "type", eventType, "error", err)
+	}
+}
+
+// Peers returns a snapshot of the peer registry
+func (a *Agent) Peers() []fleet.Peer {
+	return a.peers.Peers()
+}
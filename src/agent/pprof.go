@@ -0,0 +1,25 @@
+package agent
+
+import (
+	"net/http"
+	"net/http/pprof"
+)
+
+// registerPprof serves the Go runtime profiles on /admin/debug/pprof/ when
+// Agent.HealthServer.Pprof is set. Like every admin route they require
+// authentication.
+func (a *Agent) registerPprof() {
+	if !a.config().Agent.HealthServer.Pprof {
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	// pprof.Index resolves profile names relative to /debug/pprof/
+	a.health.HandleAdmin("/admin/debug/pprof/", http.StripPrefix("/admin", mux))
+}
@@ -0,0 +1,71 @@
+package agent
+
+import (
+	"runtime"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+)
+
+// Metric groups in Report.Metrics
+const (
+	MetricsHost  = "host"
+	MetricsAgent = "agent"
+)
+
+// SelfMetrics describes the agent process, to spot leaks and back pressure
+// in the agent itself
+type SelfMetrics struct {
+	Goroutines     int     `json:"goroutines"`
+	HeapAllocBytes uint64  `json:"heap_alloc_bytes"`
+	HeapInuseBytes uint64  `json:"heap_inuse_bytes"`
+	SysBytes       uint64  `json:"sys_bytes"`
+	GCCount        uint32  `json:"gc_count"`
+	GCLastPauseMs  float64 `json:"gc_last_pause_ms"`
+	GCPauseTotalMs float64 `json:"gc_pause_total_ms"`
+
+	ChecksInFlight        int64  `json:"checks_in_flight"`
+	NatsCallbacksInFlight int    `json:"nats_callbacks_in_flight"`
+	NatsCallbackCapacity  int    `json:"nats_callback_capacity"`
+	ReportsDropped        uint64 `json:"reports_dropped"`
+
+	// Seconds since the last report was published successfully; absent
+	// until the first one
+	LastReportAgeSeconds float64 `json:"last_report_age_seconds,omitempty"`
+}
+
+// reportMetrics returns the metrics included in every report
+func (a *Agent) reportMetrics() map[string]interface{} {
+	return map[string]interface{}{
+		MetricsHost:  a.host.Collect(a.config().System.WorkDir),
+		MetricsAgent: a.selfMetrics(),
+	}
+}
+
+// selfMetrics samples the agent's runtime and internal queues
+func (a *Agent) selfMetrics() SelfMetrics {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	m := SelfMetrics{
+		Goroutines:     runtime.NumGoroutine(),
+		HeapAllocBytes: mem.HeapAlloc,
+		HeapInuseBytes: mem.HeapInuse,
+		SysBytes:       mem.Sys,
+		GCCount:        mem.NumGC,
+		GCPauseTotalMs: reporter.Milliseconds(time.Duration(mem.PauseTotalNs)),
+
+		ChecksInFlight:        a.checksInFlight.Load(),
+		NatsCallbacksInFlight: nats.CallbacksInFlight(),
+		NatsCallbackCapacity:  nats.CallbackCapacity(),
+		ReportsDropped:        a.reporter.Dropped(),
+	}
+	if mem.NumGC > 0 {
+		m.GCLastPauseMs = reporter.Milliseconds(time.Duration(mem.PauseNs[(mem.NumGC+255)%256]))
+	}
+	if last := a.reporter.LastReport(); !last.IsZero() {
+		m.LastReportAgeSeconds = time.Since(last).Seconds()
+	}
+	return m
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+	"github.com/nats-io/nats.go/micro"
+)
+
+// ServiceName is the name the agent registers under in NATS service discovery
+const ServiceName = "ibp-geodns-agent"
+
+// semVer matches the versions accepted by NATS service discovery
+var semVer = regexp.MustCompile(`^(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\+([0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*))?$`)
+
+// CheckInfo is a configured check together with its latest result
+type CheckInfo struct {
+	Config config.ServiceConfig   `json:"config"`
+	Status reporter.ServiceStatus `json:"status"`
+	Paused bool                   `json:"paused"`
+}
+
+// startService registers the agent as a NATS micro service with status,
+// checks, config, sla and history endpoints under agent.svc.<AgentID>
+func (a *Agent) startService() error {
+	metadata := map[string]string{
+		"agent_id": a.config().Agent.AgentID,
+		"node_id":  a.config().Nats.NodeID,
+	}
+	for key, value := range a.version {
+		metadata[key] = value
+	}
+	if prefix := a.subjects.Prefix(); prefix != "" {
+		metadata["subject_prefix"] = prefix
+	}
+	if region := a.config().Agent.Consensus.Region; region != "" {
+		metadata["region"] = region
+	}
+
+	svc, err := nats.AddService(micro.Config{
+		Name:        ServiceName,
+		Version:     serviceVersion(a.version["version"]),
+		Description: "IBP GeoDNS monitoring agent " + a.config().Agent.AgentID,
+		Metadata:    metadata,
+		ErrorHandler: func(_ micro.Service, err *micro.NATSError) {
+			logging.Warn("NATS service error", "subject", err.Subject, "error", err.Description)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	group := svc.AddGroup(a.subjects.Service(a.config().Agent.AgentID))
+	endpoints := []struct {
+		name    string
+		handler micro.HandlerFunc
+	}{
+		{"status", a.handleServiceStatus},
+		{"checks", a.handleServiceChecks},
+		{"config", a.handleServiceConfig},
+		{"sla", a.handleServiceSLA},
+		{"history", a.handleServiceHistory},
+	}
+	for _, endpoint := range endpoints {
+		if err := group.AddEndpoint(endpoint.name, endpoint.handler); err != nil {
+			_ = svc.Stop()
+			return err
+		}
+	}
+
+	a.service = svc
+	logging.Info("Registered NATS service", "name", ServiceName, "id", svc.Info().ID, "subjects", a.subjects.Service(a.config().Agent.AgentID)+".*")
+	return nil
+}
+
+// stopService removes the service registration
+func (a *Agent) stopService() {
+	if a.service == nil {
+		return
+	}
+	if err := a.service.Stop(); err != nil {
+		logging.Warn("Failed to stop NATS service", "error", err)
+	}
+	a.service = nil
+}
+
+func (a *Agent) handleServiceStatus(req micro.Request) {
+	respondJSON(req, a.Status())
+}
+
+func (a *Agent) handleServiceChecks(req micro.Request) {
+	filter, ok := serviceFilter(req)
+	if !ok {
+		return
+	}
+
+	statuses := a.reporter.ServiceStatuses()
+	var checks []CheckInfo
+	for _, service := range a.config().Redacted().Agent.ServicesToMonitor {
+		if filter != "" && service.Name != filter {
+			continue
+		}
+		status, checked := statuses[service.Name]
+		if !checked {
+			status = reporter.ServiceStatus{Name: service.Name, Status: "pending"}
+		}
+		checks = append(checks, CheckInfo{Config: service, Status: status, Paused: a.isPaused(service.Name)})
+	}
+	if filter != "" && len(checks) == 0 {
+		_ = req.Error("404", "unknown service "+filter, nil)
+		return
+	}
+	respondJSON(req, checks)
+}
+
+func (a *Agent) handleServiceConfig(req micro.Request) {
+	respondJSON(req, a.config().Redacted())
+}
+
+func (a *Agent) handleServiceSLA(req micro.Request) {
+	filter, ok := serviceFilter(req)
+	if !ok {
+		return
+	}
+	sla, err := a.SLA(filter)
+	if err != nil {
+		_ = req.Error("404", err.Error(), nil)
+		return
+	}
+	respondJSON(req, sla)
+}
+
+// serviceFilter reads the optional service name from a request payload
+// shaped like CommandRequest. ok is false if an error reply was sent.
+func serviceFilter(req micro.Request) (name string, ok bool) {
+	if len(req.Data()) == 0 {
+		return "", true
+	}
+	var body CommandRequest
+	if err := json.Unmarshal(req.Data(), &body); err != nil {
+		_ = req.Error("400", "invalid request payload: "+err.Error(), nil)
+		return "", false
+	}
+	return body.Service, true
+}
+
+func respondJSON(req micro.Request, v interface{}) {
+	if err := req.RespondJSON(v); err != nil {
+		logging.Warn("Failed to respond to service request", "subject", req.Subject(), "error", err)
+	}
+}
+
+// serviceVersion returns version if it is a semantic version, which NATS
+// service discovery requires, and 0.0.0 otherwise. The raw version is also
+// published in the service metadata.
+func serviceVersion(version string) string {
+	version = strings.TrimPrefix(version, "v")
+	if semVer.MatchString(version) {
+		return version
+	}
+	return "0.0.0"
+}
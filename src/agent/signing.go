@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/signing"
+	"github.com/ibp-network/ibp-geodns-agent/src/subjects"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+// EventKeyRotated announces a new signing key, signed with the old one
+const EventKeyRotated = "signing_key_rotated"
+
+// startSigning loads the signing key and follows key rotations announced by
+// other agents
+func (a *Agent) startSigning() error {
+	if err := a.updateSigner(); err != nil {
+		return err
+	}
+
+	sub, err := nats.Subscribe(a.subjects.AllEvents(EventKeyRotated), a.handleKeyRotation)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to key rotations: %w", err)
+	}
+	a.subs = append(a.subs, sub)
+	return nil
+}
+
+// updateSigner loads Agent.Signing.SeedFile. If the key changed, the new
+// key is announced in an event signed with the old key before it is used.
+func (a *Agent) updateSigner() error {
+	seedFile := a.config().Agent.Signing.SeedFile
+	if seedFile == "" {
+		if a.signingKey != "" {
+			logging.Warn("Message signing disabled", "previousKey", a.signingKey)
+			nats.SetSigner(nil)
+			a.signingKey = ""
+		}
+		return nil
+	}
+
+	signer, err := signing.LoadSigner(seedFile)
+	if err != nil {
+		return err
+	}
+	if signer.PublicKey() == a.signingKey {
+		return nil
+	}
+
+	if a.signingKey != "" {
+		rotation := signing.KeyRotation{OldKey: a.signingKey, NewKey: signer.PublicKey()}
+		if err := a.reporter.PublishEvent(EventKeyRotated, rotation); err != nil {
+			logging.Warn("Failed to announce signing key rotation", "error", err)
+		}
+		logging.Info("Signing key rotated", "oldKey", rotation.OldKey, "newKey", rotation.NewKey)
+	} else {
+		logging.Info("Signing published messages", "publicKey", signer.PublicKey())
+	}
+	nats.SetSigner(signer)
+	a.signingKey = signer.PublicKey()
+	return nil
+}
+
+// handleKeyRotation pins the new key of a peer that rotated its signing key
+func (a *Agent) handleKeyRotation(msg *natsgo.Msg) {
+	var event struct {
+		AgentID string              `json:"agent_id"`
+		Data    signing.KeyRotation `json:"data"`
+	}
+	if err := json.Unmarshal(msg.Data, &event); err != nil {
+		logging.Debug("Ignoring malformed key rotation", "subject", msg.Subject, "error", err)
+		return
+	}
+	if event.AgentID == "" || event.AgentID == a.config().Agent.AgentID {
+		return
+	}
+	if !a.sentBy(event.AgentID, msg) {
+		return
+	}
+
+	if err := a.keys.Rotate(event.AgentID, msg, event.Data); err != nil {
+		logging.Warn("Rejected peer key rotation", "peer", event.AgentID, "error", err)
+		return
+	}
+	logging.Info("Peer signing key rotated", "peer", event.AgentID, "newKey", event.Data.NewKey)
+}
+
+// sentBy reports whether msg was published on a subject of agentID. The
+// signature covers the subject, so this ties a signed payload to the agent
+// named in it and stops one agent speaking, or pinning a key, for another.
+func (a *Agent) sentBy(agentID string, msg *natsgo.Msg) bool {
+	token, ok := a.subjects.AgentToken(msg.Subject)
+	if !ok || token != subjects.Token(agentID) {
+		logging.Warn("Ignoring peer message published on another agent's subject", "peer", agentID, "subject", msg.Subject)
+		return false
+	}
+	return true
+}
+
+// verifyPeer reports whether a message from another agent may be used.
+// Messages with a bad signature or a key other than the one pinned for the
+// agent are always dropped; unsigned ones when requireSigned is set.
+func (a *Agent) verifyPeer(agentID string, msg *natsgo.Msg, requireSigned bool) bool {
+	err := a.keys.Verify(agentID, msg)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, signing.ErrUnsigned) && !requireSigned:
+		return true
+	default:
+		logging.Warn("Ignoring peer message that failed verification", "peer", agentID, "subject", msg.Subject, "error", err)
+		return false
+	}
+}
+
+// requireSignedVotes reports whether consensus observations must be signed:
+// with Agent.Signing.RequirePeers, or once this agent signs or trusts keys,
+// since an unsigned vote could otherwise outvote the verified ones
+func requireSignedVotes(cfg *config.Config) bool {
+	signingCfg := cfg.Agent.Signing
+	return signingCfg.RequirePeers || signingCfg.SeedFile != "" || len(signingCfg.TrustedKeys) > 0
+}
@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/signing"
+	"github.com/ibp-network/ibp-geodns-agent/src/subjects"
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+func TestSentBy(t *testing.T) {
+	b := subjects.New("prod")
+	a := &Agent{subjects: b}
+
+	tests := []struct {
+		name    string
+		agentID string
+		subject string
+		want    bool
+	}{
+		{"own report subject", "a1", b.Report("a1"), true},
+		{"own event subject", "a1", b.Event("a1", EventKeyRotated), true},
+		{"escaped agent ID", "eu.1", b.Observation("eu.1"), true},
+		{"another agent's subject", "a1", b.Report("a2"), false},
+		{"other namespace", "a1", subjects.New("").Report("a1"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := a.sentBy(tt.agentID, &natsgo.Msg{Subject: tt.subject}); got != tt.want {
+				t.Errorf("sentBy(%q, %q) = %v, want %v", tt.agentID, tt.subject, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequireSignedVotes(t *testing.T) {
+	tests := []struct {
+		name    string
+		signing config.SigningConfig
+		want    bool
+	}{
+		{"signing not configured", config.SigningConfig{}, false},
+		{"peers must sign", config.SigningConfig{RequirePeers: true}, true},
+		{"agent signs", config.SigningConfig{SeedFile: "/etc/agent.nk"}, true},
+		{"trusted keys", config.SigningConfig{TrustedKeys: map[string]string{"a2": "UKEY"}}, true},
+		{"command keys only", config.SigningConfig{CommandKeys: map[string]string{"ops": "UKEY"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			cfg.Agent.Signing = tt.signing
+			if got := requireSignedVotes(cfg); got != tt.want {
+				t.Errorf("requireSignedVotes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestSigner loads a signer with a fresh user key
+func newTestSigner(t *testing.T) *signing.Signer {
+	t.Helper()
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	seed, _ := kp.Seed()
+	seedFile := filepath.Join(t.TempDir(), "agent.nk")
+	if err := os.WriteFile(seedFile, seed, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := signing.LoadSigner(seedFile)
+	if err != nil {
+		t.Fatalf("LoadSigner: %v", err)
+	}
+	return signer
+}
+
+func TestVerifyPeer(t *testing.T) {
+	signer := newTestSigner(t)
+
+	subject := subjects.New("").Observation("a2")
+	unsigned := &natsgo.Msg{Subject: subject, Data: []byte("{}"), Header: natsgo.Header{}}
+	signed := &natsgo.Msg{Subject: subject, Data: []byte("{}"), Header: natsgo.Header{}}
+	if err := signer.Sign(subject, signed.Data, signed.Header); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		msg           *natsgo.Msg
+		requireSigned bool
+		want          bool
+	}{
+		{"unsigned accepted", unsigned, false, true},
+		{"unsigned dropped when signatures are required", unsigned, true, false},
+		{"signed", signed, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Agent{keys: signing.NewKeyRing(nil)}
+			if got := a.verifyPeer("a2", tt.msg, tt.requireSigned); got != tt.want {
+				t.Errorf("verifyPeer = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
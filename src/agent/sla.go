@@ -0,0 +1,129 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+)
+
+// SLA summarises a service's availability since the agent started and, with
+// Agent.History enabled, over recent windows. Degraded results count as
+// available; only down results count against it.
+type SLA struct {
+	Service      string      `json:"service"`
+	Since        time.Time   `json:"since"`
+	Checks       uint64      `json:"checks"`
+	Available    uint64      `json:"available"`
+	Availability float64     `json:"availability"` // percent of checks not down
+	LastDown     *time.Time  `json:"last_down,omitempty"`
+	Windows      []SLAWindow `json:"windows,omitempty"`
+}
+
+// SLAWindow is the availability over a recent period, read from the check
+// history, so it survives restarts
+type SLAWindow struct {
+	Window       string  `json:"window"`
+	Checks       uint64  `json:"checks"`
+	Availability float64 `json:"availability"` // percent of checks not down
+}
+
+// slaWindows are the periods reported in SLA.Windows
+var slaWindows = []struct {
+	name   string
+	period time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// slaTracker counts check outcomes per service
+type slaTracker struct {
+	mu       sync.Mutex
+	services map[string]*SLA
+}
+
+func newSLATracker() *slaTracker {
+	return &slaTracker{services: make(map[string]*SLA)}
+}
+
+// record counts one reported check result
+func (t *slaTracker) record(status reporter.ServiceStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sla, ok := t.services[status.Name]
+	if !ok {
+		sla = &SLA{Service: status.Name, Since: status.LastCheck}
+		t.services[status.Name] = sla
+	}
+	sla.Checks++
+	if status.Status == "down" {
+		lastDown := status.LastCheck
+		sla.LastDown = &lastDown
+	} else {
+		sla.Available++
+	}
+	sla.Availability = 100 * float64(sla.Available) / float64(sla.Checks)
+}
+
+// get returns the SLA of a service, or a zero SLA if it was never checked
+func (t *slaTracker) get(service string) SLA {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sla, ok := t.services[service]
+	if !ok {
+		return SLA{Service: service}
+	}
+	out := *sla
+	if sla.LastDown != nil {
+		lastDown := *sla.LastDown
+		out.LastDown = &lastDown
+	}
+	return out
+}
+
+// SLA returns the availability of the named service, or of every configured
+// service if name is empty
+func (a *Agent) SLA(name string) ([]SLA, error) {
+	services := a.config().Services()
+	if name != "" {
+		service, err := a.findService(name)
+		if err != nil {
+			return nil, err
+		}
+		services = []config.ServiceConfig{service}
+	}
+
+	out := make([]SLA, 0, len(services))
+	for _, service := range services {
+		sla := a.sla.get(service.Name)
+		sla.Windows = a.slaWindows(service.Name)
+		out = append(out, sla)
+	}
+	return out, nil
+}
+
+// slaWindows returns the availability of service over each of slaWindows,
+// or nil if there is no check history
+func (a *Agent) slaWindows(service string) []SLAWindow {
+	if a.history == nil {
+		return nil
+	}
+
+	now := time.Now()
+	windows := make([]SLAWindow, 0, len(slaWindows))
+	for _, w := range slaWindows {
+		summary, err := a.history.Summary(service, now.Add(-w.period))
+		if err != nil {
+			logging.Warn("Failed to read check history", "service", service, "error", err)
+			return nil
+		}
+		windows = append(windows, SLAWindow{Window: w.name, Checks: summary.Checks, Availability: summary.Availability})
+	}
+	return windows
+}
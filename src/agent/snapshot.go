@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"fmt"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/subjects"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+// startSnapshots answers requests for a full report on
+// agent.snapshot.<AgentID> and agent.snapshot.all
+func (a *Agent) startSnapshots() error {
+	patterns := []string{
+		a.subjects.Snapshot(a.config().Agent.AgentID),
+		a.subjects.Snapshot(subjects.Broadcast),
+	}
+
+	for _, subject := range patterns {
+		sub, err := nats.Subscribe(subject, a.handleSnapshot)
+		if err != nil {
+			return fmt.Errorf("failed to subscribe to %s: %w", subject, err)
+		}
+		a.subs = append(a.subs, sub)
+	}
+	return nil
+}
+
+// handleSnapshot replies with a full report, encoded like published reports
+func (a *Agent) handleSnapshot(msg *natsgo.Msg) {
+	if msg.Reply == "" {
+		return
+	}
+
+	reply, err := a.reporter.Snapshot(msg.Reply)
+	if err != nil {
+		logging.Error("Failed to build snapshot", "error", err)
+		return
+	}
+	if err := nats.PublishMsg(reply); err != nil {
+		logging.Warn("Failed to reply with snapshot", "error", err)
+	}
+}
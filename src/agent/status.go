@@ -0,0 +1,116 @@
+package agent
+
+import (
+	"os"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/database"
+	"github.com/ibp-network/ibp-geodns-agent/src/fleet"
+	"github.com/ibp-network/ibp-geodns-agent/src/matrix"
+	"github.com/ibp-network/ibp-geodns-agent/src/metrics"
+	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+)
+
+// Status is the payload served by the health server's /status endpoint
+type Status struct {
+	AgentID       string                            `json:"agent_id"`
+	NodeID        string                            `json:"node_id"`
+	Hostname      string                            `json:"hostname"`
+	BootID        string                            `json:"boot_id"`
+	Version       map[string]string                 `json:"version"`
+	StartedAt     time.Time                         `json:"started_at"`
+	Uptime        string                            `json:"uptime"`
+	Nats          NatsStatus                        `json:"nats"`
+	ConfigHash    string                            `json:"config_hash"`
+	SigningKey    string                            `json:"signing_key,omitempty"`
+	LastReport    *time.Time                        `json:"last_report,omitempty"`
+	Agent         SelfMetrics                       `json:"agent"`
+	Database      *database.Stats                   `json:"database,omitempty"`
+	Notifications *matrix.Stats                     `json:"notifications,omitempty"`
+	Services      map[string]reporter.ServiceStatus `json:"services"`
+	Paused        []string                          `json:"paused,omitempty"`
+	Peers         []fleet.Peer                      `json:"peers"`
+}
+
+// NatsStatus describes the state of the NATS connection
+type NatsStatus struct {
+	Connected         bool                   `json:"connected"`
+	State             string                 `json:"state"`
+	ConnectedURL      string                 `json:"connected_url,omitempty"`
+	ServerID          string                 `json:"server_id,omitempty"`
+	ServerName        string                 `json:"server_name,omitempty"`
+	Cluster           string                 `json:"cluster,omitempty"`
+	Servers           []string               `json:"servers,omitempty"`            // seeds and discovered servers
+	DiscoveredServers []string               `json:"discovered_servers,omitempty"` // cluster routes learned from the server
+	Reconnects        uint64                 `json:"reconnects"`
+	History           []nats.ConnectionEvent `json:"history,omitempty"`
+}
+
+// SetVersionInfo sets the build information reported by /status
+func (a *Agent) SetVersionInfo(info map[string]string) {
+	a.version = info
+	a.reporter.SetVersion(info["version"])
+	metrics.SetBuildInfo(info)
+}
+
+// Status returns a snapshot of the agent's identity and current state
+func (a *Agent) Status() Status {
+	hostname, _ := os.Hostname()
+
+	status := Status{
+		AgentID:       a.config().Agent.AgentID,
+		NodeID:        a.config().Nats.NodeID,
+		Hostname:      hostname,
+		Version:       a.version,
+		StartedAt:     a.startedAt,
+		BootID:        a.reporter.BootID(),
+		ConfigHash:    a.config().Hash(),
+		SigningKey:    nats.SigningKey(),
+		Nats:          natsStatus(),
+		Paused:        a.pausedServices(),
+		Peers:         a.Peers(),
+		Agent:         a.selfMetrics(),
+		Database:      a.databaseStats(),
+		Notifications: a.notificationStats(),
+	}
+	if !a.startedAt.IsZero() {
+		status.Uptime = time.Since(a.startedAt).Round(time.Second).String()
+	}
+	if last := a.reporter.LastReport(); !last.IsZero() {
+		status.LastReport = &last
+	}
+
+	// Every configured service is listed, including ones not checked yet
+	services := a.config().Services()
+	checked := a.reporter.ServiceStatuses()
+	status.Services = make(map[string]reporter.ServiceStatus, len(services))
+	for _, service := range services {
+		current, ok := checked[service.Name]
+		if !ok {
+			current = reporter.ServiceStatus{Name: service.Name, Status: "pending"}
+		}
+		status.Services[service.Name] = current
+	}
+
+	return status
+}
+
+func natsStatus() NatsStatus {
+	conn := nats.GetConnection()
+	if conn == nil {
+		return NatsStatus{State: "NOT_INITIALIZED"}
+	}
+	return NatsStatus{
+		Connected:         conn.IsConnected(),
+		State:             conn.Status().String(),
+		ConnectedURL:      conn.ConnectedUrlRedacted(),
+		ServerID:          conn.ConnectedServerId(),
+		ServerName:        conn.ConnectedServerName(),
+		Cluster:           conn.ConnectedClusterName(),
+		Servers:           conn.Servers(),
+		DiscoveredServers: conn.DiscoveredServers(),
+		Reconnects:        nats.Reconnects(),
+		History:           nats.History(),
+	}
+}
@@ -0,0 +1,155 @@
+// Package codec encodes agent payloads as JSON or CBOR, optionally zstd
+// compressed, and describes the encoding in NATS headers so consumers can
+// decode them.
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/klauspost/compress/zstd"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+// Headers describing how a payload is encoded
+const (
+	HeaderContentType     = "Content-Type"
+	HeaderContentEncoding = "Content-Encoding"
+)
+
+// Content types set in HeaderContentType
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeCBOR = "application/cbor"
+)
+
+// Formats and compressions accepted by New
+const (
+	FormatJSON      = "json"
+	FormatCBOR      = "cbor"
+	CompressionNone = "none"
+	CompressionZstd = "zstd"
+)
+
+// maxDecodedSize bounds decompressed payloads so a small message cannot
+// expand into an arbitrarily large allocation
+const maxDecodedSize = 64 << 20
+
+var (
+	cborEnc = sync.OnceValue(func() cbor.EncMode {
+		mode, err := cbor.EncOptions{Time: cbor.TimeUnixDynamic, TimeTag: cbor.EncTagRequired}.EncMode()
+		if err != nil {
+			panic(err)
+		}
+		return mode
+	})
+	cborDec = sync.OnceValue(func() cbor.DecMode {
+		mode, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}.DecMode()
+		if err != nil {
+			panic(err)
+		}
+		return mode
+	})
+	zstdEnc = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	})
+	zstdDec = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxDecodedSize))
+	})
+)
+
+// Codec encodes payloads in one format and compression
+type Codec struct {
+	format      string
+	compression string
+}
+
+// New returns a codec for format (json or cbor) and compression (none or
+// zstd). Empty values select json and none.
+func New(format, compression string) (Codec, error) {
+	if format == "" {
+		format = FormatJSON
+	}
+	if compression == "" {
+		compression = CompressionNone
+	}
+	if format != FormatJSON && format != FormatCBOR {
+		return Codec{}, fmt.Errorf("unsupported format %q", format)
+	}
+	if compression != CompressionNone && compression != CompressionZstd {
+		return Codec{}, fmt.Errorf("unsupported compression %q", compression)
+	}
+	return Codec{format: format, compression: compression}, nil
+}
+
+// String describes the codec, e.g. "cbor+zstd"
+func (c Codec) String() string {
+	if c.compression == CompressionZstd {
+		return c.format + "+" + c.compression
+	}
+	return c.format
+}
+
+// Marshal encodes v and sets the headers describing the encoding on header
+func (c Codec) Marshal(v interface{}, header natsgo.Header) ([]byte, error) {
+	var (
+		data        []byte
+		contentType string
+		err         error
+	)
+	switch c.format {
+	case FormatCBOR:
+		data, err = cborEnc().Marshal(v)
+		contentType = ContentTypeCBOR
+	default:
+		data, err = json.Marshal(v)
+		contentType = ContentTypeJSON
+	}
+	if err != nil {
+		return nil, err
+	}
+	header.Set(HeaderContentType, contentType)
+
+	if c.compression == CompressionZstd {
+		enc, err := zstdEnc()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		data = enc.EncodeAll(data, nil)
+		header.Set(HeaderContentEncoding, CompressionZstd)
+	}
+	return data, nil
+}
+
+// Decode decodes msg into v according to its headers. Messages without a
+// content type are JSON, as published by agents before encodings were
+// configurable.
+func Decode(msg *natsgo.Msg, v interface{}) error {
+	data := msg.Data
+
+	switch encoding := msg.Header.Get(HeaderContentEncoding); encoding {
+	case "":
+	case CompressionZstd:
+		dec, err := zstdDec()
+		if err != nil {
+			return fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		if data, err = dec.DecodeAll(data, nil); err != nil {
+			return fmt.Errorf("failed to decompress payload: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+
+	switch contentType := msg.Header.Get(HeaderContentType); contentType {
+	case "", ContentTypeJSON:
+		return json.Unmarshal(data, v)
+	case ContentTypeCBOR:
+		return cborDec().Unmarshal(data, v)
+	default:
+		return fmt.Errorf("unsupported content type %q", contentType)
+	}
+}
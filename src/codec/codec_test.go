@@ -0,0 +1,129 @@
+package codec
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+type payload struct {
+	AgentID   string            `json:"agent_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Latency   float64           `json:"latency_ms"`
+	Labels    map[string]string `json:"labels"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := payload{AgentID: "a1", Timestamp: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC), Latency: 12.5, Labels: map[string]string{"region": "eu"}}
+
+	tests := []struct {
+		format, compression string
+		contentType         string
+		contentEncoding     string
+	}{
+		{"", "", ContentTypeJSON, ""},
+		{FormatJSON, CompressionZstd, ContentTypeJSON, CompressionZstd},
+		{FormatCBOR, CompressionNone, ContentTypeCBOR, ""},
+		{FormatCBOR, CompressionZstd, ContentTypeCBOR, CompressionZstd},
+	}
+	for _, tt := range tests {
+		c, err := New(tt.format, tt.compression)
+		if err != nil {
+			t.Fatalf("New(%q, %q): %v", tt.format, tt.compression, err)
+		}
+		t.Run(c.String(), func(t *testing.T) {
+			msg := &natsgo.Msg{Header: natsgo.Header{}}
+			if msg.Data, err = c.Marshal(in, msg.Header); err != nil {
+				t.Fatalf("Marshal: %v", err)
+			}
+			if got := msg.Header.Get(HeaderContentType); got != tt.contentType {
+				t.Errorf("Content-Type %q, want %q", got, tt.contentType)
+			}
+			if got := msg.Header.Get(HeaderContentEncoding); got != tt.contentEncoding {
+				t.Errorf("Content-Encoding %q, want %q", got, tt.contentEncoding)
+			}
+
+			var out payload
+			if err := Decode(msg, &out); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if out.AgentID != in.AgentID || !out.Timestamp.Equal(in.Timestamp) || out.Latency != in.Latency || out.Labels["region"] != "eu" {
+				t.Errorf("decoded %+v, want %+v", out, in)
+			}
+		})
+	}
+}
+
+func TestNewRejectsUnknownEncodings(t *testing.T) {
+	for _, args := range [][2]string{{"protobuf", ""}, {"", "gzip"}} {
+		if _, err := New(args[0], args[1]); err == nil {
+			t.Errorf("New(%q, %q) succeeded", args[0], args[1])
+		}
+	}
+}
+
+func TestDecodeHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		header natsgo.Header
+		data   string
+		err    string
+	}{
+		// Agents published plain JSON before encodings were configurable
+		{"no headers", nil, `{"agent_id":"a1"}`, ""},
+		{"no content type", natsgo.Header{}, `{"agent_id":"a1"}`, ""},
+		{"unknown content type", natsgo.Header{HeaderContentType: {"application/x-protobuf"}}, `{"agent_id":"a1"}`, "unsupported content type"},
+		{"unknown content encoding", natsgo.Header{HeaderContentEncoding: {"gzip"}}, `{"agent_id":"a1"}`, "unsupported content encoding"},
+		{"corrupt zstd", natsgo.Header{HeaderContentEncoding: {CompressionZstd}}, "not zstd", "failed to decompress"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out payload
+			err := Decode(&natsgo.Msg{Header: tt.header, Data: []byte(tt.data)}, &out)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("Decode: %v", err)
+			case tt.err == "" && out.AgentID != "a1":
+				t.Errorf("decoded %+v", out)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("Decode: got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeLimitsDecompressedSize(t *testing.T) {
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+
+	// A JSON string of zeros compresses to a few KiB whatever its size
+	bomb := func(size int) []byte {
+		raw := make([]byte, size)
+		for i := range raw {
+			raw[i] = '0'
+		}
+		raw[0], raw[size-1] = '"', '"'
+		return enc.EncodeAll(raw, nil)
+	}
+	header := natsgo.Header{HeaderContentEncoding: {CompressionZstd}}
+
+	var s string
+	small := bomb(1 << 20)
+	if err := Decode(&natsgo.Msg{Header: header, Data: small}, &s); err != nil || len(s) != 1<<20-2 {
+		t.Errorf("1 MiB payload: decoded %d bytes, error %v", len(s), err)
+	}
+
+	large := bomb(maxDecodedSize + 1<<20)
+	if len(large) > 1<<20 {
+		t.Fatalf("bomb compressed to %d bytes", len(large))
+	}
+	if err := Decode(&natsgo.Msg{Header: header, Data: large}, &s); err == nil || !strings.Contains(err.Error(), "failed to decompress") {
+		t.Errorf("payload over %d bytes: got %v, want a decompression error", maxDecodedSize, err)
+	}
+}
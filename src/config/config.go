@@ -1,68 +1,193 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 
-	"github.com/ibp-network/ibp-geodns-libs/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/codec"
 	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-libs/config"
 )
 
-// Config represents the agent configuration structure
+// Config represents the agent configuration structure. A loaded Config is
+// never modified; reloads publish a new one through a Store, so a *Config may
+// be read without locking.
 type Config struct {
 	System      SystemConfig      `json:"System"`
-	Nats        NatsConfig        `json:"Nats"`
+	Nats        NatsConfig        `json:"Nats" jsonschema:"required"`
 	Mysql       MysqlConfig       `json:"Mysql,omitempty"`
 	Matrix      MatrixConfig      `json:"Matrix,omitempty"`
 	CollatorApi CollatorApiConfig `json:"CollatorApi,omitempty"`
 	Agent       AgentConfig       `json:"Agent"`
 
-	mu sync.RWMutex
+	hash     string
+	path     string
+	overlays []Overlay
 }
 
 // SystemConfig contains system-level configuration
 type SystemConfig struct {
-	WorkDir           string                `json:"WorkDir"`
-	LogLevel          string                `json:"LogLevel"`
-	ConfigUrls        ConfigUrls            `json:"ConfigUrls"`
-	ConfigReloadTime  int                   `json:"ConfigReloadTime"`  // seconds
-	MinimumOfflineTime int                  `json:"MinimumOfflineTime"` // seconds
+	WorkDir            string         `json:"WorkDir"`
+	LogLevel           string         `json:"LogLevel"`
+	ConfigUrls         ConfigUrls     `json:"ConfigUrls"`
+	ConfigKV           ConfigKVConfig `json:"ConfigKV,omitempty"`
+	ConfigReloadTime   int            `json:"ConfigReloadTime" jsonschema:"minimum=0"`   // seconds
+	MinimumOfflineTime int            `json:"MinimumOfflineTime" jsonschema:"minimum=0"` // seconds
 }
 
 // ConfigUrls contains URLs for remote configuration
 type ConfigUrls struct {
-	StaticDNSConfig      string `json:"StaticDNSConfig"`
-	MembersConfig        string `json:"MembersConfig"`
-	ServicesConfig       string `json:"ServicesConfig"`
-	IaasPricingConfig    string `json:"IaasPricingConfig,omitempty"`
+	StaticDNSConfig        string `json:"StaticDNSConfig"`
+	MembersConfig          string `json:"MembersConfig"`
+	ServicesConfig         string `json:"ServicesConfig"`
+	IaasPricingConfig      string `json:"IaasPricingConfig,omitempty"`
 	ServicesRequestsConfig string `json:"ServicesRequestsConfig,omitempty"`
 }
 
+// ConfigKVConfig sources Agent overrides from a JetStream KV bucket
+type ConfigKVConfig struct {
+	Bucket     string `json:"Bucket,omitempty"`     // empty disables KV config
+	DefaultKey string `json:"DefaultKey,omitempty"` // key shared by every agent, applied before the agent's own key
+}
+
+// Enabled reports whether overrides are read from a KV bucket
+func (k ConfigKVConfig) Enabled() bool {
+	return k.Bucket != ""
+}
+
+// Overlay is a partial Agent section, such as {"ServicesToMonitor": [...]},
+// applied on top of the configuration file. It comes from a remote source,
+// so it may only set the fields of overlayFields.
+type Overlay struct {
+	Source string
+	Data   []byte
+}
+
+// overlayFields are the Agent settings an overlay may override. Signing,
+// the health server, NATS credentials and the other settings that decide
+// who the agent trusts or what it runs only come from the file.
+type overlayFields struct {
+	CheckInterval          *int             `json:"CheckInterval"`
+	ReportFailureThreshold *int             `json:"ReportFailureThreshold"`
+	PeerLostThreshold      *int             `json:"PeerLostThreshold"`
+	ServicesToMonitor      *[]ServiceConfig `json:"ServicesToMonitor"`
+}
+
+// apply copies the fields set in the overlay onto agent
+func (o overlayFields) apply(agent *AgentConfig) {
+	if o.CheckInterval != nil {
+		agent.CheckInterval = *o.CheckInterval
+	}
+	if o.ReportFailureThreshold != nil {
+		agent.ReportFailureThreshold = *o.ReportFailureThreshold
+	}
+	if o.PeerLostThreshold != nil {
+		agent.PeerLostThreshold = *o.PeerLostThreshold
+	}
+	if o.ServicesToMonitor != nil {
+		agent.ServicesToMonitor = *o.ServicesToMonitor
+	}
+}
+
 // NatsConfig contains NATS connection configuration
 type NatsConfig struct {
-	NodeID string `json:"NodeID"`
-	Url    string `json:"Url"`
-	User   string `json:"User"`
-	Pass   string `json:"Pass"`
+	NodeID  string   `json:"NodeID" jsonschema:"required"`
+	Url     string   `json:"Url,omitempty"`     // single server or comma-separated list
+	Servers []string `json:"Servers,omitempty"` // seed servers, combined with Url
+	User    string   `json:"User"`
+	Pass    string   `json:"Pass"`
+
+	ServerOrder         string `json:"ServerOrder,omitempty" jsonschema:"enum=random|ordered"` // default random
+	ReconnectBufferSize int    `json:"ReconnectBufferSize,omitempty"`                          // bytes buffered while reconnecting; 0 uses the client default, -1 disables
+	PingInterval        int    `json:"PingInterval,omitempty" jsonschema:"minimum=0"`          // seconds between server pings
+	MaxPingsOutstanding int    `json:"MaxPingsOutstanding,omitempty" jsonschema:"minimum=0"`   // unanswered pings before the connection is considered stale
+
+	SubjectPrefix string `json:"SubjectPrefix,omitempty"` // namespace prepended to every subject, e.g. "staging"
+
+	TLSCA        string `json:"TLSCA,omitempty"`        // PEM bundle used to verify the servers
+	TLSCert      string `json:"TLSCert,omitempty"`      // client certificate presented to the servers
+	TLSKey       string `json:"TLSKey,omitempty"`       // client certificate key
+	NKeySeedFile string `json:"NKeySeedFile,omitempty"` // nkey user seed file
+	CredsFile    string `json:"CredsFile,omitempty"`    // decentralized JWT user credentials (.creds)
+}
+
+// NATS server selection orders
+const (
+	ServerOrderRandom  = "random"
+	ServerOrderOrdered = "ordered"
+)
+
+// ServerURLs returns the configured seed servers from Url and Servers in
+// order, without duplicates
+func (n NatsConfig) ServerURLs() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, raw := range append(strings.Split(n.Url, ","), n.Servers...) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || seen[raw] {
+			continue
+		}
+		seen[raw] = true
+		urls = append(urls, raw)
+	}
+	return urls
+}
+
+// TLSEnabled reports whether custom TLS settings are configured for NATS
+func (n NatsConfig) TLSEnabled() bool {
+	return n.TLSCA != "" || n.TLSCert != "" || n.TLSKey != ""
 }
 
-// MysqlConfig contains MySQL database configuration
+// AuthMethod names the configured NATS authentication method
+func (n NatsConfig) AuthMethod() string {
+	switch {
+	case n.CredsFile != "":
+		return "creds"
+	case n.NKeySeedFile != "":
+		return "nkey"
+	case n.User != "":
+		return "user"
+	default:
+		return "none"
+	}
+}
+
+// MysqlConfig contains MySQL database configuration. When Enabled, check
+// results, state changes and incidents are written to the database.
 type MysqlConfig struct {
-	Host string `json:"Host"`
-	Port string `json:"Port"`
-	User string `json:"User"`
-	Pass string `json:"Pass"`
-	DB   string `json:"DB"`
+	Enabled       bool   `json:"Enabled"`
+	Host          string `json:"Host"`
+	Port          string `json:"Port"`
+	User          string `json:"User"`
+	Pass          string `json:"Pass"`
+	DB            string `json:"DB"`
+	BatchSize     int    `json:"BatchSize,omitempty" jsonschema:"minimum=0,maximum=1000"` // rows written per transaction
+	FlushInterval int    `json:"FlushInterval,omitempty" jsonschema:"minimum=0"`          // seconds between writes
+	QueueSize     int    `json:"QueueSize,omitempty" jsonschema:"minimum=0"`              // rows buffered while the database is slow or unreachable
 }
 
-// MatrixConfig contains Matrix notification configuration
+// MatrixConfig contains Matrix notification configuration. When Enabled,
+// status changes are posted to the room.
 type MatrixConfig struct {
-	HomeServerURL string `json:"HomeServerURL"`
-	Username      string `json:"Username"`
-	Password      string `json:"Password"`
-	RoomID        string `json:"RoomID"`
+	Enabled        bool   `json:"Enabled"`
+	HomeServerURL  string `json:"HomeServerURL"`
+	Username       string `json:"Username"`
+	Password       string `json:"Password"`
+	RoomID         string `json:"RoomID"`                                          // room ID or alias
+	RateLimit      int    `json:"RateLimit,omitempty" jsonschema:"minimum=0"`      // messages per minute
+	DedupWindow    int    `json:"DedupWindow,omitempty" jsonschema:"minimum=0"`    // seconds before an identical notification is posted again
+	FlapThreshold  int    `json:"FlapThreshold,omitempty" jsonschema:"minimum=0"`  // status changes within FlapWindow that mark a service as flapping
+	FlapWindow     int    `json:"FlapWindow,omitempty" jsonschema:"minimum=0"`     // seconds
+	CertExpiryDays int    `json:"CertExpiryDays,omitempty" jsonschema:"minimum=0"` // warn when a checked certificate expires within this many days
 }
 
 // CollatorApiConfig contains collator API configuration
@@ -73,22 +198,93 @@ type CollatorApiConfig struct {
 
 // AgentConfig contains agent-specific configuration
 type AgentConfig struct {
-	AgentID           string          `json:"AgentID"`
-	ReportInterval    int             `json:"ReportInterval"`    // seconds
-	CheckInterval     int             `json:"CheckInterval"`     // seconds
-	HealthCheckPort   int             `json:"HealthCheckPort"`
-	ServicesToMonitor []ServiceConfig `json:"ServicesToMonitor"`
+	AgentID                string             `json:"AgentID"`
+	ReportInterval         int                `json:"ReportInterval" jsonschema:"minimum=0"`                   // seconds
+	ReportFailureThreshold int                `json:"ReportFailureThreshold,omitempty" jsonschema:"minimum=0"` // seconds of failed publishing before /health fails
+	ReportEncoding         EncodingConfig     `json:"ReportEncoding,omitempty"`
+	DeltaReports           DeltaReportsConfig `json:"DeltaReports,omitempty"`
+	History                HistoryConfig      `json:"History,omitempty"`
+	CheckInterval          int                `json:"CheckInterval" jsonschema:"minimum=0"` // seconds
+	HealthCheckPort        int                `json:"HealthCheckPort" jsonschema:"minimum=0,maximum=65535"`
+	HealthServer           HealthServerConfig `json:"HealthServer,omitempty"`
+	Consensus              ConsensusConfig    `json:"Consensus,omitempty"`
+	Signing                SigningConfig      `json:"Signing,omitempty"`
+	PeerLostThreshold      int                `json:"PeerLostThreshold,omitempty" jsonschema:"minimum=0"` // seconds without a report before a peer agent is flagged lost
+	ShutdownTimeout        int                `json:"ShutdownTimeout,omitempty" jsonschema:"minimum=0"`   // seconds allowed for a graceful shutdown
+	CheckDrainTimeout      int                `json:"CheckDrainTimeout,omitempty" jsonschema:"minimum=0"` // seconds to wait for in-flight checks on shutdown
+	ServicesToMonitor      []ServiceConfig    `json:"ServicesToMonitor"`
+}
+
+// EncodingConfig selects how payloads are encoded on the wire
+type EncodingConfig struct {
+	Format      string `json:"Format,omitempty" jsonschema:"enum=json|cbor"`      // default json
+	Compression string `json:"Compression,omitempty" jsonschema:"enum=none|zstd"` // default none
+}
+
+// DeltaReportsConfig controls publishing only changed services between full
+// snapshot reports
+type DeltaReportsConfig struct {
+	Enabled          bool `json:"Enabled"`
+	SnapshotInterval int  `json:"SnapshotInterval,omitempty" jsonschema:"minimum=0"` // seconds between full reports
+	LatencyChange    int  `json:"LatencyChange,omitempty" jsonschema:"minimum=0"`    // percent latency change that is reported
+}
+
+// HistoryConfig controls the on-disk history of check results kept under
+// System.WorkDir
+type HistoryConfig struct {
+	Enabled         bool `json:"Enabled"`
+	RawRetention    int  `json:"RawRetention,omitempty" jsonschema:"minimum=0"`    // days of individual results
+	MinuteRetention int  `json:"MinuteRetention,omitempty" jsonschema:"minimum=0"` // days of 1m rollups
+	HourRetention   int  `json:"HourRetention,omitempty" jsonschema:"minimum=0"`   // days of 1h rollups
+}
+
+// SigningConfig controls signing of published messages and verification of
+// messages from peer agents
+type SigningConfig struct {
+	SeedFile     string            `json:"SeedFile,omitempty"`     // nkey seed signing every published message; empty disables signing
+	RequirePeers bool              `json:"RequirePeers,omitempty"` // ignore unsigned peer reports and observations
+	TrustedKeys  map[string]string `json:"TrustedKeys,omitempty"`  // AgentID -> public key; other agents are pinned on first use
+	CommandKeys  map[string]string `json:"CommandKeys,omitempty"`  // operator -> public key; when set, NATS commands must be signed by one of them
+}
+
+// ConsensusConfig controls multi-agent agreement before a service is declared offline
+type ConsensusConfig struct {
+	Enabled         bool   `json:"Enabled"`
+	Region          string `json:"Region,omitempty"`                        // this agent's region label
+	Quorum          int    `json:"Quorum,omitempty" jsonschema:"minimum=0"` // agents (or regions) that must see a service down
+	Window          int    `json:"Window,omitempty" jsonschema:"minimum=0"` // seconds an observation stays valid
+	DistinctRegions bool   `json:"DistinctRegions,omitempty"`               // count distinct regions rather than agents
+}
+
+// HealthServerConfig contains health server listener, TLS and access control configuration
+type HealthServerConfig struct {
+	BindAddress string   `json:"BindAddress,omitempty"` // empty listens on all interfaces
+	TLSCert     string   `json:"TLSCert,omitempty"`     // defaults to $SSL_CERT
+	TLSKey      string   `json:"TLSKey,omitempty"`      // defaults to $SSL_KEY
+	ClientCA    string   `json:"ClientCA,omitempty"`    // PEM bundle; enables mTLS client authentication
+	AuthTokens  []string `json:"AuthTokens,omitempty"`  // accepted bearer tokens
+	Pprof       bool     `json:"Pprof,omitempty"`       // serve Go profiles on /admin/debug/pprof/
+}
+
+// TLSEnabled reports whether the health server serves HTTPS
+func (h HealthServerConfig) TLSEnabled() bool {
+	return h.TLSCert != "" || h.TLSKey != ""
+}
+
+// AuthEnabled reports whether endpoints other than /live require authentication
+func (h HealthServerConfig) AuthEnabled() bool {
+	return len(h.AuthTokens) > 0 || h.ClientCA != ""
 }
 
 // ServiceConfig defines a service to monitor
 type ServiceConfig struct {
-	Name             string `json:"Name"`
-	Type             string `json:"Type"` // http, tcp, custom
+	Name             string `json:"Name" jsonschema:"required"`
+	Type             string `json:"Type" jsonschema:"required,description=check type: http|tcp|custom"` // http, tcp, custom
 	URL              string `json:"URL,omitempty"`
 	Endpoint         string `json:"Endpoint,omitempty"`
-	Timeout          int    `json:"Timeout"`          // seconds
-	Interval         int    `json:"Interval"`         // seconds
-	ExpectedStatus   int    `json:"ExpectedStatus,omitempty"`
+	Timeout          int    `json:"Timeout" jsonschema:"minimum=0"`  // seconds
+	Interval         int    `json:"Interval" jsonschema:"minimum=0"` // seconds
+	ExpectedStatus   int    `json:"ExpectedStatus,omitempty" jsonschema:"minimum=0,maximum=599"`
 	ExpectedResponse string `json:"ExpectedResponse,omitempty"`
 }
 
@@ -99,23 +295,44 @@ var (
 
 // Load loads configuration from file
 func Load(configPath string) (*Config, error) {
+	return load(configPath, nil)
+}
+
+// load reads the configuration file and applies overlays in order
+func load(configPath string, overlays []Overlay) (*Config, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var cfg Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+	// Parse and validate configuration
+	cfg, warnings, err := decode(data)
+	for _, warning := range warnings {
+		logging.Warn("Config warning", "detail", warning)
+	}
+	if err != nil {
+		var issues ValidationErrors
+		if errors.As(err, &issues) {
+			return nil, fmt.Errorf("config validation failed: %w", err)
+		}
+		return nil, err
 	}
 
-	// Set defaults
-	cfg.setDefaults()
+	if len(overlays) > 0 {
+		if err := cfg.applyOverlays(overlays); err != nil {
+			return nil, err
+		}
+	}
 
-	// Validate configuration
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("config validation failed: %w", err)
+	// The hash covers the overlays so it identifies the effective revision
+	hash := sha256.New()
+	hash.Write(data)
+	for _, overlay := range overlays {
+		hash.Write(overlay.Data)
 	}
+	cfg.hash = hex.EncodeToString(hash.Sum(nil))
+	cfg.path = configPath
+	cfg.overlays = overlays
 
 	// Load remote config if URLs are provided
 	if err := cfg.loadRemoteConfig(); err != nil {
@@ -124,10 +341,79 @@ func Load(configPath string) (*Config, error) {
 	}
 
 	configMu.Lock()
-	globalConfig = &cfg
+	globalConfig = cfg
 	configMu.Unlock()
 
-	return &cfg, nil
+	return cfg, nil
+}
+
+// decode parses raw config JSON, applies defaults and validates the result
+// against both the embedded JSON Schema and Validate. Unknown fields are
+// returned as warnings. A ValidationErrors error means the document was
+// well-formed but invalid.
+func decode(data []byte) (*Config, []string, error) {
+	schemaIssues, warnings, mismatched, err := validateSchema(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+
+	// Fields of the wrong type are reported by the schema; Unmarshal leaves
+	// them at their zero value and decodes the rest, so the other problems
+	// are reported too
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) || len(mismatched) == 0 {
+			return nil, warnings, fmt.Errorf("failed to parse config: %w", err)
+		}
+	}
+
+	// Set defaults
+	cfg.setDefaults()
+
+	var issues ValidationErrors
+	if err := cfg.Validate(); err != nil {
+		for _, issue := range err.(ValidationErrors) {
+			// Problems with the zero value standing in for a mismatched field
+			// say nothing about the configuration
+			if !mismatched[issue.Path] {
+				issues = append(issues, issue)
+			}
+		}
+	}
+	if issues = mergeIssues(issues, schemaIssues); len(issues) > 0 {
+		return &cfg, warnings, issues
+	}
+	return &cfg, warnings, nil
+}
+
+// applyOverlays decodes each overlay onto the Agent section and validates
+// the result. Fields absent from an overlay keep their current value; lists
+// such as ServicesToMonitor are replaced as a whole. Fields other than those
+// of overlayFields and custom services are rejected.
+func (c *Config) applyOverlays(overlays []Overlay) error {
+	for _, overlay := range overlays {
+		var fields overlayFields
+		dec := json.NewDecoder(bytes.NewReader(overlay.Data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&fields); err != nil {
+			return fmt.Errorf("invalid config overlay %s: %w (overlays may only set CheckInterval, ReportFailureThreshold, PeerLostThreshold and ServicesToMonitor)", overlay.Source, err)
+		}
+		if fields.ServicesToMonitor != nil {
+			for _, svc := range *fields.ServicesToMonitor {
+				if svc.Type == ServiceTypeCustom {
+					return fmt.Errorf("invalid config overlay %s: service %q: custom checks run commands and are only accepted from the config file", overlay.Source, svc.Name)
+				}
+			}
+		}
+		fields.apply(&c.Agent)
+	}
+
+	c.setDefaults()
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("config validation failed after applying overlays: %w", err)
+	}
+	return nil
 }
 
 // Get returns the global configuration (thread-safe)
@@ -154,42 +440,104 @@ func (c *Config) setDefaults() {
 	if c.Agent.ReportInterval == 0 {
 		c.Agent.ReportInterval = 60
 	}
+	if c.Agent.ReportFailureThreshold == 0 {
+		c.Agent.ReportFailureThreshold = 300
+	}
+	if c.Agent.PeerLostThreshold == 0 {
+		c.Agent.PeerLostThreshold = 3 * c.Agent.ReportInterval
+	}
+	if c.System.ConfigKV.Enabled() && c.System.ConfigKV.DefaultKey == "" {
+		c.System.ConfigKV.DefaultKey = "default"
+	}
+	if c.Agent.ShutdownTimeout == 0 {
+		c.Agent.ShutdownTimeout = 30
+	}
+	if c.Agent.CheckDrainTimeout == 0 {
+		// A third of the shutdown, but at least a second so short timeouts
+		// still let quick checks finish
+		c.Agent.CheckDrainTimeout = max(c.Agent.ShutdownTimeout/3, 1)
+	}
 	if c.Agent.CheckInterval == 0 {
 		c.Agent.CheckInterval = 30
 	}
+	if c.Agent.Consensus.Quorum == 0 {
+		c.Agent.Consensus.Quorum = 2
+	}
+	if c.Agent.Consensus.Window == 0 {
+		c.Agent.Consensus.Window = 3 * c.Agent.CheckInterval
+	}
 	if c.Agent.HealthCheckPort == 0 {
 		c.Agent.HealthCheckPort = 8080
 	}
-	if c.Agent.AgentID == "" {
-		hostname, _ := os.Hostname()
-		c.Agent.AgentID = hostname
+	if c.Agent.History.RawRetention == 0 {
+		c.Agent.History.RawRetention = 2
 	}
-}
-
-// Validate validates the configuration
-func (c *Config) Validate() error {
-	if c.Nats.Url == "" {
-		return fmt.Errorf("NATS URL is required")
+	if c.Agent.History.MinuteRetention == 0 {
+		c.Agent.History.MinuteRetention = 14
 	}
-	if c.Nats.NodeID == "" {
-		return fmt.Errorf("NATS NodeID is required")
+	if c.Agent.History.HourRetention == 0 {
+		c.Agent.History.HourRetention = 400
 	}
-	if c.Agent.AgentID == "" {
-		return fmt.Errorf("AgentID is required")
+	if c.Agent.DeltaReports.SnapshotInterval == 0 {
+		c.Agent.DeltaReports.SnapshotInterval = 10 * c.Agent.ReportInterval
 	}
-	if c.Agent.ReportInterval <= 0 {
-		return fmt.Errorf("Agent.ReportInterval must be greater than 0")
+	if c.Agent.DeltaReports.LatencyChange == 0 {
+		c.Agent.DeltaReports.LatencyChange = 50
 	}
-	if c.Agent.CheckInterval <= 0 {
-		return fmt.Errorf("Agent.CheckInterval must be greater than 0")
+	if c.Agent.ReportEncoding.Format == "" {
+		c.Agent.ReportEncoding.Format = codec.FormatJSON
 	}
-	if c.Agent.HealthCheckPort <= 0 || c.Agent.HealthCheckPort > 65535 {
-		return fmt.Errorf("Agent.HealthCheckPort must be between 1 and 65535")
+	if c.Agent.ReportEncoding.Compression == "" {
+		c.Agent.ReportEncoding.Compression = codec.CompressionNone
 	}
-	if c.System.ConfigReloadTime < 0 {
-		return fmt.Errorf("System.ConfigReloadTime cannot be negative")
+	if c.Mysql.Enabled {
+		if c.Mysql.Port == "" {
+			c.Mysql.Port = "3306"
+		}
+		if c.Mysql.BatchSize == 0 {
+			c.Mysql.BatchSize = 500
+		}
+		if c.Mysql.FlushInterval == 0 {
+			c.Mysql.FlushInterval = 5
+		}
+		if c.Mysql.QueueSize == 0 {
+			c.Mysql.QueueSize = 10000
+		}
+	}
+	if c.Matrix.Enabled {
+		if c.Matrix.RateLimit == 0 {
+			c.Matrix.RateLimit = 10
+		}
+		if c.Matrix.DedupWindow == 0 {
+			c.Matrix.DedupWindow = 86400
+		}
+		if c.Matrix.FlapThreshold == 0 {
+			c.Matrix.FlapThreshold = 4
+		}
+		if c.Matrix.FlapWindow == 0 {
+			c.Matrix.FlapWindow = 600
+		}
+		if c.Matrix.CertExpiryDays == 0 {
+			c.Matrix.CertExpiryDays = 14
+		}
+	}
+	if c.Nats.ServerOrder == "" {
+		c.Nats.ServerOrder = ServerOrderRandom
+	}
+	if c.Nats.PingInterval == 0 {
+		c.Nats.PingInterval = 20
+	}
+	if c.Nats.MaxPingsOutstanding == 0 {
+		c.Nats.MaxPingsOutstanding = 3
+	}
+	if c.Agent.HealthServer.TLSCert == "" && c.Agent.HealthServer.TLSKey == "" {
+		c.Agent.HealthServer.TLSCert = os.Getenv("SSL_CERT")
+		c.Agent.HealthServer.TLSKey = os.Getenv("SSL_KEY")
+	}
+	if c.Agent.AgentID == "" {
+		hostname, _ := os.Hostname()
+		c.Agent.AgentID = hostname
 	}
-	return nil
 }
 
 // loadRemoteConfig loads configuration from remote URLs using ibp-geodns-libs
@@ -208,16 +556,124 @@ func (c *Config) loadRemoteConfig() error {
 	return fmt.Errorf("remote config loading is not implemented yet")
 }
 
-// Reload reloads configuration from file
-func (c *Config) Reload(configPath string) error {
-	newCfg, err := Load(configPath)
+// Store holds the configuration in effect and replaces it as a whole on
+// reload
+type Store struct {
+	current  atomic.Pointer[Config]
+	reloadMu sync.Mutex
+}
+
+// NewStore creates a store holding cfg
+func NewStore(cfg *Config) *Store {
+	s := &Store{}
+	s.current.Store(cfg)
+	return s
+}
+
+// Current returns the configuration in effect
+func (s *Store) Current() *Config {
+	return s.current.Load()
+}
+
+// Reload reloads the configuration file, reapplying the current overlays
+func (s *Store) Reload() error {
+	return s.ReloadWithOverlays(s.Current().Overlays())
+}
+
+// ReloadWithOverlays reloads the configuration file and applies overlays,
+// which are kept for later reloads. The current configuration is left in
+// effect if the result is invalid.
+func (s *Store) ReloadWithOverlays(overlays []Overlay) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	next, err := load(s.Current().Path(), overlays)
 	if err != nil {
 		return err
 	}
+	s.current.Store(next)
+	return nil
+}
 
-	configMu.Lock()
-	*globalConfig = *newCfg
-	configMu.Unlock()
+// Overlays returns the overlays applied on top of the configuration file
+func (c *Config) Overlays() []Overlay {
+	return append([]Overlay(nil), c.overlays...)
+}
 
-	return nil
+// redactedValue replaces secrets in Redacted
+const redactedValue = "REDACTED"
+
+// Redacted returns a copy of the configuration with passwords and tokens
+// replaced, safe to expose to operators
+func (c *Config) Redacted() *Config {
+	out := &Config{
+		System:      c.System,
+		Nats:        c.Nats,
+		Mysql:       c.Mysql,
+		Matrix:      c.Matrix,
+		CollatorApi: c.CollatorApi,
+		Agent:       c.Agent,
+		hash:        c.hash,
+		path:        c.path,
+	}
+	redact := func(secret *string) {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	redact(&out.Nats.Pass)
+	redact(&out.Mysql.Pass)
+	redact(&out.Matrix.Password)
+	tokens := make([]string, len(c.Agent.HealthServer.AuthTokens))
+	for i := range tokens {
+		tokens[i] = redactedValue
+	}
+	out.Agent.HealthServer.AuthTokens = tokens
+	out.Agent.ServicesToMonitor = append([]ServiceConfig(nil), c.Agent.ServicesToMonitor...)
+	for i := range out.Agent.ServicesToMonitor {
+		out.Agent.ServicesToMonitor[i].URL = redactURL(out.Agent.ServicesToMonitor[i].URL)
+	}
+
+	// Server URLs may carry credentials
+	urls := strings.Split(c.Nats.Url, ",")
+	for i := range urls {
+		urls[i] = redactURL(urls[i])
+	}
+	out.Nats.Url = strings.Join(urls, ",")
+	out.Nats.Servers = make([]string, len(c.Nats.Servers))
+	for i, server := range c.Nats.Servers {
+		out.Nats.Servers[i] = redactURL(server)
+	}
+	return out
+}
+
+// redactURL hides a URL's user info, which may be a password or a token
+func redactURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = url.User(redactedValue)
+	return u.String()
+}
+
+// Path returns the file the configuration was loaded from
+func (c *Config) Path() string {
+	return c.path
+}
+
+// Services returns a copy of Agent.ServicesToMonitor
+func (c *Config) Services() []ServiceConfig {
+	return append([]ServiceConfig(nil), c.Agent.ServicesToMonitor...)
+}
+
+// LogLevel returns System.LogLevel
+func (c *Config) LogLevel() string {
+	return c.System.LogLevel
+}
+
+// Hash returns the SHA-256 of the configuration file the config was loaded
+// from, so operators can tell which revision an agent is running
+func (c *Config) Hash() string {
+	return c.hash
 }
@@ -0,0 +1,364 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validJSON = `{
+	"System": {"WorkDir": "/tmp/agent", "LogLevel": "Info"},
+	"Nats": {"NodeID": "node-1", "Url": "nats://127.0.0.1:4222"},
+	"Agent": {
+		"AgentID": "agent-1",
+		"ReportInterval": 60,
+		"CheckInterval": 30,
+		"HealthCheckPort": 8080,
+		"ServicesToMonitor": [
+			{"Name": "web", "Type": "http", "URL": "https://example.com/health", "Timeout": 10, "Interval": 60}
+		]
+	}
+}`
+
+// validConfig returns a decoded configuration that passes validation
+func validConfig(t *testing.T) *Config {
+	t.Helper()
+	cfg, _, err := decode([]byte(validJSON))
+	if err != nil {
+		t.Fatalf("decode valid config: %v", err)
+	}
+	return cfg
+}
+
+// issuePaths returns the paths of the issues in err
+func issuePaths(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var issues ValidationErrors
+	if !errors.As(err, &issues) {
+		t.Fatalf("expected ValidationErrors, got %T: %v", err, err)
+	}
+	paths := make([]string, len(issues))
+	for i, issue := range issues {
+		paths[i] = issue.Path
+	}
+	return paths
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(c *Config)
+		paths  []string
+	}{
+		{"valid", func(c *Config) {}, nil},
+		{"unknown log level", func(c *Config) { c.System.LogLevel = "Loud" }, []string{"System.LogLevel"}},
+		{"missing node ID", func(c *Config) { c.Nats.NodeID = " " }, []string{"Nats.NodeID"}},
+		{"no NATS servers", func(c *Config) { c.Nats.Url = "" }, []string{"Nats.Url"}},
+		{"bad NATS scheme", func(c *Config) { c.Nats.Url = "http://127.0.0.1:4222" }, []string{"Nats.Url"}},
+		{"invalid server order", func(c *Config) { c.Nats.ServerOrder = "fastest" }, []string{"Nats.ServerOrder"}},
+		{"several NATS auth methods", func(c *Config) {
+			c.Nats.User = "agent"
+			c.Nats.CredsFile = "/nonexistent.creds"
+		}, []string{"Nats", "Nats.CredsFile"}},
+		{"health port out of range", func(c *Config) { c.Agent.HealthCheckPort = 99999 }, []string{"Agent.HealthCheckPort"}},
+		{"drain timeout not below shutdown timeout", func(c *Config) { c.Agent.CheckDrainTimeout = c.Agent.ShutdownTimeout }, []string{"Agent.CheckDrainTimeout"}},
+		{"shutdown timeout too short to drain", func(c *Config) {
+			c.Agent.ShutdownTimeout = 1
+			c.Agent.CheckDrainTimeout = 1
+		}, []string{"Agent.ShutdownTimeout"}},
+		{"reserved agent ID", func(c *Config) { c.Agent.AgentID = "all" }, []string{"Agent.AgentID"}},
+		{"http service without URL", func(c *Config) { c.Agent.ServicesToMonitor[0].URL = "" }, []string{"Agent.ServicesToMonitor[0].URL"}},
+		{"unknown service type", func(c *Config) { c.Agent.ServicesToMonitor[0].Type = "ftp" }, []string{"Agent.ServicesToMonitor[0].Type"}},
+		{"tcp service without port", func(c *Config) {
+			c.Agent.ServicesToMonitor[0] = ServiceConfig{Name: "db", Type: ServiceTypeTCP, Endpoint: "db.example.com"}
+		}, []string{"Agent.ServicesToMonitor[0].Endpoint"}},
+		{"timeout longer than interval", func(c *Config) { c.Agent.ServicesToMonitor[0].Timeout = 120 }, []string{"Agent.ServicesToMonitor[0].Timeout"}},
+		{"duplicate service name", func(c *Config) {
+			c.Agent.ServicesToMonitor = append(c.Agent.ServicesToMonitor, c.Agent.ServicesToMonitor[0])
+		}, []string{"Agent.ServicesToMonitor[1].Name"}},
+		{"mysql without database", func(c *Config) {
+			c.Mysql = MysqlConfig{Enabled: true, Host: "127.0.0.1", User: "agent", BatchSize: 500, QueueSize: 100}
+		}, []string{"Mysql.DB", "Mysql.QueueSize"}},
+		{"disabled mysql is not validated", func(c *Config) {
+			c.Mysql = MysqlConfig{Host: "127.0.0.1", User: "agent", BatchSize: 500, QueueSize: 100}
+		}, nil},
+		{"matrix room without prefix", func(c *Config) {
+			c.Matrix = MatrixConfig{Enabled: true, HomeServerURL: "https://matrix.example.com", Username: "bot", Password: "pw", RoomID: "alerts"}
+		}, []string{"Matrix.RoomID"}},
+		{"disabled matrix is not validated", func(c *Config) {
+			c.Matrix = MatrixConfig{HomeServerURL: "https://matrix.example.com", Username: "bot", RoomID: "alerts"}
+		}, nil},
+		{"distinct regions without region", func(c *Config) {
+			c.Agent.Consensus.Enabled = true
+			c.Agent.Consensus.DistinctRegions = true
+		}, []string{"Agent.Consensus.Region"}},
+		{"every problem at once", func(c *Config) {
+			c.System.LogLevel = "Loud"
+			c.Agent.HealthCheckPort = -1
+			c.Agent.ServicesToMonitor[0].Type = ""
+		}, []string{"System.LogLevel", "Agent.HealthCheckPort", "Agent.ServicesToMonitor[0].Type"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.mutate(cfg)
+			got := issuePaths(t, cfg.Validate())
+			if strings.Join(got, ",") != strings.Join(tt.paths, ",") {
+				t.Errorf("issues at %v, want %v", got, tt.paths)
+			}
+		})
+	}
+}
+
+func TestDecodeReportsEveryProblem(t *testing.T) {
+	data := `{
+		"System": {"WorkDir": "/tmp/agent", "LogLevel": "Loud"},
+		"Nats": {"NodeID": "node-1", "Url": "nats://127.0.0.1:4222"},
+		"Agent": {
+			"AgentID": "agent-1",
+			"HealthCheckPort": 99999,
+			"ServicesToMonitor": [
+				{"Name": "a", "Type": "http"},
+				{"Name": "b", "Type": "ftp", "Timeout": -1},
+				{"Name": "a", "Type": "tcp", "Endpoint": "db:3306", "Timeout": "5"}
+			]
+		}
+	}`
+
+	_, _, err := decode([]byte(data))
+	paths := issuePaths(t, err)
+	for _, want := range []string{
+		"System.LogLevel",
+		"Agent.HealthCheckPort",
+		"Agent.ServicesToMonitor[0].URL",
+		"Agent.ServicesToMonitor[1].Type",
+		"Agent.ServicesToMonitor[1].Timeout",
+		"Agent.ServicesToMonitor[2].Name",
+		"Agent.ServicesToMonitor[2].Timeout",
+	} {
+		if !containsString(paths, want) {
+			t.Errorf("missing issue at %s; got %v", want, paths)
+		}
+	}
+
+	// The mismatched Timeout decodes as zero, which must not be reported as
+	// a problem of its own
+	var count int
+	for _, path := range paths {
+		if path == "Agent.ServicesToMonitor[2].Timeout" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("got %d issues for the mismatched Timeout, want 1", count)
+	}
+}
+
+func TestDecodeUnknownFieldIsWarning(t *testing.T) {
+	data := strings.Replace(validJSON, `"LogLevel": "Info"`, `"LogLevel": "Info", "Colour": "blue"`, 1)
+	_, warnings, err := decode([]byte(data))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "System.Colour") {
+		t.Errorf("warnings = %v, want one for System.Colour", warnings)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	_, _, err := decode([]byte(`{"System": `))
+	var issues ValidationErrors
+	if err == nil || errors.As(err, &issues) {
+		t.Errorf("got %v, want a parse error", err)
+	}
+}
+
+func TestMergeIssues(t *testing.T) {
+	base := ValidationErrors{
+		{Path: "Agent.HealthCheckPort", Message: "must be between 1 and 65535"},
+		{Path: "Agent.HealthCheckPort", Message: "is reserved"},
+	}
+	extra := ValidationErrors{
+		{Path: "Agent.HealthCheckPort", Message: "must be <= 65535, got 99999"},
+		{Path: "Nats.Url", Message: "is required"},
+		{Path: "Nats.Url", Message: "is required"},
+		{Path: "Nats.NodeID", Message: "expected string, got number"},
+	}
+	got := mergeIssues(base, extra)
+	want := ValidationErrors{base[0], base[1], extra[1], extra[3]}
+	if len(got) != len(want) {
+		t.Fatalf("merged %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("issue %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecodeReportsEachPathOnce(t *testing.T) {
+	// The schema (minimum) and Validate both reject the negative timeout
+	data := strings.Replace(validJSON, `"Timeout": 10`, `"Timeout": -1`, 1)
+	_, _, err := decode([]byte(data))
+	paths := issuePaths(t, err)
+	if len(paths) != 1 || paths[0] != "Agent.ServicesToMonitor[0].Timeout" {
+		t.Errorf("issues at %v, want one at Agent.ServicesToMonitor[0].Timeout", paths)
+	}
+}
+
+func TestDecodeAcceptsNullLists(t *testing.T) {
+	data := strings.Replace(validJSON, `"HealthCheckPort": 8080,`, `"HealthCheckPort": 8080, "HealthServer": {"AuthTokens": null},`, 1)
+	if _, _, err := decode([]byte(data)); err != nil {
+		t.Errorf("decode: %v", err)
+	}
+}
+
+func TestCheckDrainTimeoutDefault(t *testing.T) {
+	tests := []struct {
+		shutdown, drain int
+	}{
+		{0, 10}, // ShutdownTimeout defaults to 30
+		{30, 10},
+		{4, 1},
+		{2, 1}, // a third rounds down to 0
+	}
+	for _, tt := range tests {
+		c := &Config{}
+		c.Agent.ShutdownTimeout = tt.shutdown
+		c.setDefaults()
+		if c.Agent.CheckDrainTimeout != tt.drain {
+			t.Errorf("ShutdownTimeout %d: CheckDrainTimeout = %d, want %d", tt.shutdown, c.Agent.CheckDrainTimeout, tt.drain)
+		}
+	}
+}
+
+func TestStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(validJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store := NewStore(cfg)
+
+	updated := strings.Replace(validJSON, `"LogLevel": "Info"`, `"LogLevel": "Debug"`, 1)
+	if err := os.WriteFile(path, []byte(updated), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := store.Current().LogLevel(); got != "Debug" {
+		t.Errorf("current LogLevel = %q, want Debug", got)
+	}
+	if got := cfg.LogLevel(); got != "Info" {
+		t.Errorf("previous snapshot changed to LogLevel %q", got)
+	}
+
+	// An invalid file leaves the current configuration in effect
+	current := store.Current()
+	if err := os.WriteFile(path, []byte(`{"Nats": {}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Reload(); err == nil {
+		t.Fatal("Reload of an invalid file succeeded")
+	}
+	if store.Current() != current {
+		t.Error("invalid reload replaced the configuration")
+	}
+}
+
+func TestStoreReloadWithOverlays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(validJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	store := NewStore(cfg)
+
+	overlays := []Overlay{{Source: "test", Data: []byte(`{"CheckInterval": 15}`)}}
+	if err := store.ReloadWithOverlays(overlays); err != nil {
+		t.Fatalf("ReloadWithOverlays: %v", err)
+	}
+	if got := store.Current().Agent.CheckInterval; got != 15 {
+		t.Errorf("CheckInterval = %d, want 15", got)
+	}
+	if store.Current().Hash() == cfg.Hash() {
+		t.Error("hash does not cover the overlays")
+	}
+
+	// Overlays are kept for later reloads
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if got := store.Current().Agent.CheckInterval; got != 15 {
+		t.Errorf("CheckInterval after reload = %d, want 15", got)
+	}
+
+	current := store.Current()
+	for _, data := range []string{
+		`{"AgentID": "other"}`,
+		`{"Unknown": 1}`,
+		`{"Signing": {"RequirePeers": false}}`,
+		`{"HealthServer": {"AuthTokens": ["token"]}}`,
+		`{"HealthCheckPort": 9090}`,
+		`{"ServicesToMonitor": [{"Name": "sh", "Type": "custom", "Endpoint": "id"}]}`,
+		`{"ServicesToMonitor": [{"Name": "rpc", "Type": "http", "URL": "https://rpc.example.com", "Unknown": 1}]}`,
+	} {
+		if err := store.ReloadWithOverlays([]Overlay{{Source: "test", Data: []byte(data)}}); err == nil {
+			t.Errorf("overlay %s was accepted", data)
+		}
+	}
+	if store.Current() != current {
+		t.Error("rejected overlay replaced the configuration")
+	}
+}
+
+func TestOverlayKeepsOtherFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(validJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	base, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	overlays := []Overlay{
+		{Source: "default", Data: []byte(`{"ServicesToMonitor": [{"Name": "wss", "Type": "tcp", "Endpoint": "wss.example.com:443"}], "ReportFailureThreshold": 600}`)},
+		{Source: "node", Data: []byte(`{"PeerLostThreshold": 900}`)},
+	}
+	cfg, err := load(path, overlays)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if services := cfg.Services(); len(services) != 1 || services[0].Name != "wss" {
+		t.Errorf("services %+v, want only wss", services)
+	}
+	if cfg.Agent.ReportFailureThreshold != 600 || cfg.Agent.PeerLostThreshold != 900 {
+		t.Errorf("thresholds %d and %d, want 600 and 900", cfg.Agent.ReportFailureThreshold, cfg.Agent.PeerLostThreshold)
+	}
+	if cfg.Agent.CheckInterval != base.Agent.CheckInterval || cfg.Agent.AgentID != base.Agent.AgentID {
+		t.Errorf("fields absent from the overlays changed: %+v", cfg.Agent)
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, value := range values {
+		if value == s {
+			return true
+		}
+	}
+	return false
+}
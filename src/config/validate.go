@@ -0,0 +1,658 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/codec"
+	"github.com/ibp-network/ibp-geodns-agent/src/schema"
+	"github.com/ibp-network/ibp-geodns-agent/src/subjects"
+	"github.com/nats-io/nkeys"
+)
+
+// Names accepted by JetStream KV
+var (
+	kvBucketName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+	kvKeyName    = regexp.MustCompile(`^[-/_=.a-zA-Z0-9]+$`)
+)
+
+// Supported service check types
+const (
+	ServiceTypeHTTP   = "http"
+	ServiceTypeTCP    = "tcp"
+	ServiceTypeCustom = "custom"
+)
+
+var validLogLevels = []string{"debug", "info", "warn", "warning", "error", "fatal"}
+
+// ValidationIssue describes a single configuration problem and where it was found
+type ValidationIssue struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// String returns the issue formatted as "path: message"
+func (i ValidationIssue) String() string {
+	if i.Path == "" {
+		return i.Message
+	}
+	return i.Path + ": " + i.Message
+}
+
+// ValidationErrors aggregates every issue found while validating a configuration
+type ValidationErrors []ValidationIssue
+
+// Error implements the error interface
+func (e ValidationErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no validation errors"
+	case 1:
+		return e[0].String()
+	}
+
+	parts := make([]string, len(e))
+	for i, issue := range e {
+		parts[i] = issue.String()
+	}
+	return fmt.Sprintf("%d validation errors: %s", len(e), strings.Join(parts, "; "))
+}
+
+// validator collects issues while walking the configuration
+type validator struct {
+	issues ValidationErrors
+}
+
+func (v *validator) addf(path, format string, args ...interface{}) {
+	v.issues = append(v.issues, ValidationIssue{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) err() error {
+	if len(v.issues) == 0 {
+		return nil
+	}
+	return v.issues
+}
+
+// Validate validates every section of the configuration. All problems are
+// reported together as ValidationErrors rather than stopping at the first.
+func (c *Config) Validate() error {
+	v := &validator{}
+	c.validateSystem(v)
+	c.validateNats(v)
+	c.validateMysql(v)
+	c.validateMatrix(v)
+	c.validateCollatorApi(v)
+	c.validateAgent(v)
+	return v.err()
+}
+
+func (c *Config) validateSystem(v *validator) {
+	s := c.System
+	if strings.TrimSpace(s.WorkDir) == "" {
+		v.addf("System.WorkDir", "is required")
+	}
+	if !containsFold(validLogLevels, s.LogLevel) {
+		v.addf("System.LogLevel", "unknown level %q (expected one of Debug, Info, Warn, Error, Fatal)", s.LogLevel)
+	}
+	if s.ConfigReloadTime < 0 {
+		v.addf("System.ConfigReloadTime", "cannot be negative")
+	}
+	if s.MinimumOfflineTime < 0 {
+		v.addf("System.MinimumOfflineTime", "cannot be negative")
+	}
+	if s.ConfigKV.Bucket != "" && !kvBucketName.MatchString(s.ConfigKV.Bucket) {
+		v.addf("System.ConfigKV.Bucket", "%q is not a valid bucket name (letters, digits, '-' and '_')", s.ConfigKV.Bucket)
+	}
+	if s.ConfigKV.DefaultKey != "" && !kvKeyName.MatchString(s.ConfigKV.DefaultKey) {
+		v.addf("System.ConfigKV.DefaultKey", "%q is not a valid key (letters, digits and '-/_=.')", s.ConfigKV.DefaultKey)
+	}
+
+	urls := map[string]string{
+		"StaticDNSConfig":        s.ConfigUrls.StaticDNSConfig,
+		"MembersConfig":          s.ConfigUrls.MembersConfig,
+		"ServicesConfig":         s.ConfigUrls.ServicesConfig,
+		"IaasPricingConfig":      s.ConfigUrls.IaasPricingConfig,
+		"ServicesRequestsConfig": s.ConfigUrls.ServicesRequestsConfig,
+	}
+	for _, name := range sortedKeys(urls) {
+		if urls[name] == "" {
+			continue
+		}
+		validateURL(v, "System.ConfigUrls."+name, urls[name], "http", "https")
+	}
+}
+
+func (c *Config) validateNats(v *validator) {
+	n := c.Nats
+	if strings.TrimSpace(n.NodeID) == "" {
+		v.addf("Nats.NodeID", "is required")
+	}
+	if len(n.ServerURLs()) == 0 {
+		v.addf("Nats.Url", "is required unless Nats.Servers is set")
+	}
+	for _, raw := range strings.Split(n.Url, ",") {
+		if strings.TrimSpace(raw) != "" {
+			validateNatsURL(v, "Nats.Url", raw)
+		}
+	}
+	for i, raw := range n.Servers {
+		validateNatsURL(v, fmt.Sprintf("Nats.Servers[%d]", i), raw)
+	}
+	if !subjects.ValidPrefix(n.SubjectPrefix) {
+		v.addf("Nats.SubjectPrefix", "%q must be dot-separated tokens without wildcards or whitespace", n.SubjectPrefix)
+	}
+	if n.ServerOrder != "" && n.ServerOrder != ServerOrderRandom && n.ServerOrder != ServerOrderOrdered {
+		v.addf("Nats.ServerOrder", "must be %q or %q, got %q", ServerOrderRandom, ServerOrderOrdered, n.ServerOrder)
+	}
+	if n.ReconnectBufferSize < -1 {
+		v.addf("Nats.ReconnectBufferSize", "must be -1 (disabled), 0 (default) or a positive number of bytes, got %d", n.ReconnectBufferSize)
+	}
+	if n.PingInterval < 0 {
+		v.addf("Nats.PingInterval", "must not be negative, got %d", n.PingInterval)
+	}
+	if n.MaxPingsOutstanding < 0 {
+		v.addf("Nats.MaxPingsOutstanding", "must not be negative, got %d", n.MaxPingsOutstanding)
+	}
+	if n.User == "" && n.Pass != "" {
+		v.addf("Nats.User", "is required when Nats.Pass is set")
+	}
+
+	methods := 0
+	for _, set := range []bool{n.User != "", n.NKeySeedFile != "", n.CredsFile != ""} {
+		if set {
+			methods++
+		}
+	}
+	if methods > 1 {
+		v.addf("Nats", "only one of User/Pass, NKeySeedFile and CredsFile may be set")
+	}
+	if n.NKeySeedFile != "" {
+		validateNKeySeedFile(v, "Nats.NKeySeedFile", n.NKeySeedFile)
+	}
+	if n.CredsFile != "" {
+		validateCredsFile(v, "Nats.CredsFile", n.CredsFile)
+	}
+
+	if n.TLSCert != "" || n.TLSKey != "" {
+		switch {
+		case n.TLSCert == "":
+			v.addf("Nats.TLSCert", "is required when TLSKey is set")
+		case n.TLSKey == "":
+			v.addf("Nats.TLSKey", "is required when TLSCert is set")
+		default:
+			if _, err := tls.LoadX509KeyPair(n.TLSCert, n.TLSKey); err != nil {
+				v.addf("Nats.TLSCert", "cannot load client certificate: %v", err)
+			}
+		}
+	}
+	if n.TLSCA != "" {
+		validateCertPoolFile(v, "Nats.TLSCA", n.TLSCA)
+	}
+}
+
+func (c *Config) validateMysql(v *validator) {
+	m := c.Mysql
+	if !m.Enabled {
+		return
+	}
+	if m.Host == "" {
+		v.addf("Mysql.Host", "is required when Mysql is enabled")
+	}
+	if m.User == "" {
+		v.addf("Mysql.User", "is required when Mysql is enabled")
+	}
+	if m.DB == "" {
+		v.addf("Mysql.DB", "is required when Mysql is enabled")
+	}
+	if m.Port != "" {
+		validatePortString(v, "Mysql.Port", m.Port)
+	}
+	if m.BatchSize < 0 || m.BatchSize > 1000 {
+		v.addf("Mysql.BatchSize", "must be between 0 and 1000, got %d", m.BatchSize)
+	}
+	if m.FlushInterval < 0 {
+		v.addf("Mysql.FlushInterval", "must not be negative, got %d", m.FlushInterval)
+	}
+	if m.QueueSize < 0 {
+		v.addf("Mysql.QueueSize", "must not be negative, got %d", m.QueueSize)
+	} else if m.QueueSize > 0 && m.QueueSize < m.BatchSize {
+		v.addf("Mysql.QueueSize", "must be at least Mysql.BatchSize (%d)", m.BatchSize)
+	}
+}
+
+func (c *Config) validateMatrix(v *validator) {
+	m := c.Matrix
+	if !m.Enabled {
+		return
+	}
+	if m.HomeServerURL == "" {
+		v.addf("Matrix.HomeServerURL", "is required when Matrix is enabled")
+	} else {
+		validateURL(v, "Matrix.HomeServerURL", m.HomeServerURL, "http", "https")
+	}
+	if m.Username == "" {
+		v.addf("Matrix.Username", "is required when Matrix is enabled")
+	}
+	if m.Password == "" {
+		v.addf("Matrix.Password", "is required when Matrix is enabled")
+	}
+	if m.RoomID == "" {
+		v.addf("Matrix.RoomID", "is required when Matrix is enabled")
+	} else if !strings.HasPrefix(m.RoomID, "!") && !strings.HasPrefix(m.RoomID, "#") {
+		v.addf("Matrix.RoomID", "%q is not a room ID (!id:server) or alias (#alias:server)", m.RoomID)
+	}
+	for _, f := range []struct {
+		path  string
+		value int
+	}{
+		{"Matrix.RateLimit", m.RateLimit},
+		{"Matrix.DedupWindow", m.DedupWindow},
+		{"Matrix.FlapThreshold", m.FlapThreshold},
+		{"Matrix.FlapWindow", m.FlapWindow},
+		{"Matrix.CertExpiryDays", m.CertExpiryDays},
+	} {
+		if f.value < 0 {
+			v.addf(f.path, "must not be negative, got %d", f.value)
+		}
+	}
+}
+
+func (c *Config) validateCollatorApi(v *validator) {
+	a := c.CollatorApi
+	if a.ListenAddress != "" && net.ParseIP(a.ListenAddress) == nil && a.ListenAddress != "localhost" {
+		v.addf("CollatorApi.ListenAddress", "%q is not a valid IP address", a.ListenAddress)
+	}
+	if a.ListenPort != "" {
+		validatePortString(v, "CollatorApi.ListenPort", a.ListenPort)
+	}
+}
+
+func (c *Config) validateAgent(v *validator) {
+	a := c.Agent
+	if strings.TrimSpace(a.AgentID) == "" {
+		v.addf("Agent.AgentID", "is required")
+	} else if subjects.Token(a.AgentID) == subjects.Broadcast {
+		v.addf("Agent.AgentID", "%q is reserved for broadcast commands", a.AgentID)
+	}
+	if a.ReportInterval <= 0 {
+		v.addf("Agent.ReportInterval", "must be greater than 0")
+	}
+	if a.ReportFailureThreshold < 0 {
+		v.addf("Agent.ReportFailureThreshold", "cannot be negative")
+	}
+	if a.PeerLostThreshold < 0 {
+		v.addf("Agent.PeerLostThreshold", "cannot be negative")
+	} else if a.PeerLostThreshold > 0 && a.ReportInterval > 0 && a.PeerLostThreshold <= a.ReportInterval {
+		v.addf("Agent.PeerLostThreshold", "must be greater than ReportInterval (%ds), got %ds", a.ReportInterval, a.PeerLostThreshold)
+	}
+	if a.ShutdownTimeout < 0 {
+		v.addf("Agent.ShutdownTimeout", "cannot be negative")
+	} else if a.ShutdownTimeout == 1 {
+		v.addf("Agent.ShutdownTimeout", "must be at least 2 seconds to drain checks and publish the final report")
+	}
+	if a.CheckDrainTimeout < 0 {
+		v.addf("Agent.CheckDrainTimeout", "cannot be negative")
+	} else if a.ShutdownTimeout > 1 && a.CheckDrainTimeout >= a.ShutdownTimeout {
+		v.addf("Agent.CheckDrainTimeout", "must be less than ShutdownTimeout (%ds) to leave time for the final report, got %ds", a.ShutdownTimeout, a.CheckDrainTimeout)
+	}
+	if a.CheckInterval <= 0 {
+		v.addf("Agent.CheckInterval", "must be greater than 0")
+	}
+	if a.HealthCheckPort <= 0 || a.HealthCheckPort > 65535 {
+		v.addf("Agent.HealthCheckPort", "must be between 1 and 65535")
+	}
+
+	validateHealthServer(v, "Agent.HealthServer", a.HealthServer)
+	validateConsensus(v, "Agent.Consensus", a.Consensus, a.CheckInterval)
+	validateSigning(v, "Agent.Signing", a.Signing)
+	validateDeltaReports(v, "Agent.DeltaReports", a.DeltaReports, a.ReportInterval)
+	validateHistory(v, "Agent.History", a.History)
+	if _, err := codec.New(a.ReportEncoding.Format, a.ReportEncoding.Compression); err != nil {
+		v.addf("Agent.ReportEncoding", "%v", err)
+	}
+
+	seen := make(map[string]int, len(a.ServicesToMonitor))
+	for i, svc := range a.ServicesToMonitor {
+		path := fmt.Sprintf("Agent.ServicesToMonitor[%d]", i)
+		validateService(v, path, svc)
+
+		name := strings.TrimSpace(svc.Name)
+		if name == "" {
+			continue
+		}
+		if first, ok := seen[name]; ok {
+			v.addf(path+".Name", "duplicate service name %q (first defined at Agent.ServicesToMonitor[%d])", name, first)
+			continue
+		}
+		seen[name] = i
+	}
+}
+
+func validateHealthServer(v *validator, path string, h HealthServerConfig) {
+	if h.BindAddress != "" && net.ParseIP(h.BindAddress) == nil && h.BindAddress != "localhost" {
+		v.addf(path+".BindAddress", "%q is not a valid IP address", h.BindAddress)
+	}
+
+	if h.TLSEnabled() {
+		if h.TLSCert == "" {
+			v.addf(path+".TLSCert", "is required when TLSKey is set")
+		} else {
+			validateReadableFile(v, path+".TLSCert", h.TLSCert)
+		}
+		if h.TLSKey == "" {
+			v.addf(path+".TLSKey", "is required when TLSCert is set")
+		} else {
+			validateReadableFile(v, path+".TLSKey", h.TLSKey)
+		}
+	}
+
+	if h.ClientCA != "" {
+		if !h.TLSEnabled() {
+			v.addf(path+".ClientCA", "requires TLSCert and TLSKey")
+		}
+		validateReadableFile(v, path+".ClientCA", h.ClientCA)
+	}
+
+	for i, token := range h.AuthTokens {
+		if strings.TrimSpace(token) == "" {
+			v.addf(fmt.Sprintf("%s.AuthTokens[%d]", path, i), "cannot be empty")
+		}
+	}
+
+	if h.Pprof && !h.AuthEnabled() {
+		v.addf(path+".Pprof", "requires AuthTokens or ClientCA")
+	}
+}
+
+func validateSigning(v *validator, path string, s SigningConfig) {
+	if s.SeedFile != "" {
+		data, err := os.ReadFile(s.SeedFile)
+		if err != nil {
+			v.addf(path+".SeedFile", "cannot read %q: %v", s.SeedFile, err)
+		} else if kp, err := nkeys.ParseDecoratedNKey(data); err != nil {
+			v.addf(path+".SeedFile", "%q does not contain a valid nkey seed: %v", s.SeedFile, err)
+		} else {
+			kp.Wipe()
+		}
+	}
+	for _, agentID := range sortedKeys(s.TrustedKeys) {
+		if !nkeys.IsValidPublicKey(s.TrustedKeys[agentID]) {
+			v.addf(fmt.Sprintf("%s.TrustedKeys.%s", path, agentID), "%q is not a public nkey", s.TrustedKeys[agentID])
+		}
+	}
+	for _, operator := range sortedKeys(s.CommandKeys) {
+		if strings.TrimSpace(operator) == "" {
+			v.addf(path+".CommandKeys", "operator names cannot be empty")
+		} else if !nkeys.IsValidPublicUserKey(s.CommandKeys[operator]) {
+			v.addf(fmt.Sprintf("%s.CommandKeys.%s", path, operator), "%q is not a public user nkey (U...)", s.CommandKeys[operator])
+		}
+	}
+}
+
+func validateConsensus(v *validator, path string, c ConsensusConfig, checkInterval int) {
+	if c.Quorum < 1 {
+		v.addf(path+".Quorum", "must be at least 1")
+	}
+	if c.Window <= 0 {
+		v.addf(path+".Window", "must be greater than 0")
+	} else if c.Enabled && checkInterval > 0 && c.Window < checkInterval {
+		v.addf(path+".Window", "must be at least CheckInterval (%ds) or observations expire between checks, got %ds", checkInterval, c.Window)
+	}
+	if c.Enabled && c.DistinctRegions && strings.TrimSpace(c.Region) == "" {
+		v.addf(path+".Region", "is required when DistinctRegions is enabled")
+	}
+}
+
+func validateDeltaReports(v *validator, path string, d DeltaReportsConfig, reportInterval int) {
+	if d.SnapshotInterval <= 0 {
+		v.addf(path+".SnapshotInterval", "must be greater than 0")
+	} else if d.Enabled && reportInterval > 0 && d.SnapshotInterval < reportInterval {
+		v.addf(path+".SnapshotInterval", "must be at least ReportInterval (%ds) or every report is a snapshot, got %ds", reportInterval, d.SnapshotInterval)
+	}
+	if d.LatencyChange <= 0 {
+		v.addf(path+".LatencyChange", "must be greater than 0")
+	}
+}
+
+func validateHistory(v *validator, path string, h HistoryConfig) {
+	if h.RawRetention <= 0 {
+		v.addf(path+".RawRetention", "must be greater than 0")
+	}
+	if h.MinuteRetention <= 0 {
+		v.addf(path+".MinuteRetention", "must be greater than 0")
+	}
+	if h.HourRetention <= 0 {
+		v.addf(path+".HourRetention", "must be greater than 0")
+	}
+}
+
+func validateReadableFile(v *validator, path, file string) {
+	f, err := os.Open(file)
+	if err != nil {
+		v.addf(path, "cannot read %q: %v", file, err)
+		return
+	}
+	f.Close()
+}
+
+func validateNatsURL(v *validator, path, raw string) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		v.addf(path, "cannot be empty")
+		return
+	}
+	// nats.go treats a bare host:port as nats://host:port
+	if !strings.Contains(raw, "://") {
+		raw = "nats://" + raw
+	}
+	validateURL(v, path, raw, "nats", "tls", "ws", "wss")
+}
+
+func validateCertPoolFile(v *validator, path, file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		v.addf(path, "cannot read %q: %v", file, err)
+		return
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM(data) {
+		v.addf(path, "%q contains no PEM certificates", file)
+	}
+}
+
+func validateNKeySeedFile(v *validator, path, file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		v.addf(path, "cannot read %q: %v", file, err)
+		return
+	}
+	kp, err := nkeys.ParseDecoratedUserNKey(data)
+	if err != nil {
+		v.addf(path, "%q does not contain a valid user nkey seed: %v", file, err)
+		return
+	}
+	kp.Wipe()
+}
+
+func validateCredsFile(v *validator, path, file string) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		v.addf(path, "cannot read %q: %v", file, err)
+		return
+	}
+	token, err := nkeys.ParseDecoratedJWT(data)
+	if err != nil || strings.Count(token, ".") != 2 {
+		v.addf(path, "%q does not contain a user JWT", file)
+		return
+	}
+	kp, err := nkeys.ParseDecoratedUserNKey(data)
+	if err != nil {
+		v.addf(path, "%q does not contain a valid user nkey seed: %v", file, err)
+		return
+	}
+	kp.Wipe()
+}
+
+func validateService(v *validator, path string, svc ServiceConfig) {
+	if strings.TrimSpace(svc.Name) == "" {
+		v.addf(path+".Name", "is required")
+	}
+
+	switch strings.ToLower(svc.Type) {
+	case ServiceTypeHTTP:
+		if svc.URL == "" {
+			v.addf(path+".URL", "is required for http services")
+		} else {
+			validateURL(v, path+".URL", svc.URL, "http", "https")
+		}
+	case ServiceTypeTCP:
+		if svc.Endpoint == "" {
+			v.addf(path+".Endpoint", "is required for tcp services")
+		} else if host, port, err := net.SplitHostPort(svc.Endpoint); err != nil || host == "" {
+			v.addf(path+".Endpoint", "must be in host:port form, got %q", svc.Endpoint)
+		} else {
+			validatePortString(v, path+".Endpoint", port)
+		}
+	case ServiceTypeCustom:
+		if strings.TrimSpace(svc.Endpoint) == "" {
+			v.addf(path+".Endpoint", "is required for custom services")
+		}
+	case "":
+		v.addf(path+".Type", "is required (expected one of http, tcp, custom)")
+	default:
+		v.addf(path+".Type", "unknown type %q (expected one of http, tcp, custom)", svc.Type)
+	}
+
+	if svc.Timeout < 0 {
+		v.addf(path+".Timeout", "cannot be negative")
+	}
+	if svc.Interval < 0 {
+		v.addf(path+".Interval", "cannot be negative")
+	}
+	if svc.Timeout > 0 && svc.Interval > 0 && svc.Timeout > svc.Interval {
+		v.addf(path+".Timeout", "must not exceed Interval (%ds), got %ds", svc.Interval, svc.Timeout)
+	}
+	if svc.ExpectedStatus != 0 && (svc.ExpectedStatus < 100 || svc.ExpectedStatus > 599) {
+		v.addf(path+".ExpectedStatus", "must be a valid HTTP status code (100-599), got %d", svc.ExpectedStatus)
+	}
+}
+
+func validateURL(v *validator, path, raw string, schemes ...string) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		v.addf(path, "invalid URL %q: %v", raw, err)
+		return
+	}
+	if !containsFold(schemes, u.Scheme) {
+		v.addf(path, "unsupported scheme in %q (expected one of %s)", raw, strings.Join(schemes, ", "))
+		return
+	}
+	if u.Host == "" {
+		v.addf(path, "URL %q has no host", raw)
+	}
+}
+
+func validatePortString(v *validator, path, raw string) {
+	port, err := strconv.Atoi(raw)
+	if err != nil || port <= 0 || port > 65535 {
+		v.addf(path, "port must be a number between 1 and 65535, got %q", raw)
+	}
+}
+
+func containsFold(values []string, s string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSchema checks raw config JSON against the embedded JSON Schema.
+// Unknown fields are returned as warnings since encoding/json ignores them;
+// every other violation is returned as an issue. mismatched holds the paths
+// of values with the wrong JSON type, which decoding leaves at zero.
+func validateSchema(data []byte) (issues ValidationErrors, warnings []string, mismatched map[string]bool, err error) {
+	found, err := schema.Validate(schema.Config(), data)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, issue := range found {
+		switch issue.Keyword {
+		case schema.KeywordAdditionalProperties:
+			warnings = append(warnings, issue.Path+": unknown field (ignored)")
+			continue
+		case schema.KeywordType:
+			if mismatched == nil {
+				mismatched = make(map[string]bool)
+			}
+			mismatched[issue.Path] = true
+		}
+		issues = append(issues, ValidationIssue{Path: issue.Path, Message: issue.Message})
+	}
+	return issues, warnings, mismatched, nil
+}
+
+// mergeIssues appends the issues in extra at paths base has no issue for,
+// so schema and semantic validation do not report the same problem twice.
+// The issues in base, the semantic ones, are kept as they are more specific.
+func mergeIssues(base, extra ValidationErrors) ValidationErrors {
+	reported := make(map[string]bool, len(base))
+	for _, issue := range base {
+		reported[issue.Path] = true
+	}
+	seen := make(map[ValidationIssue]bool, len(extra))
+	for _, issue := range extra {
+		if !reported[issue.Path] && !seen[issue] {
+			seen[issue] = true
+			base = append(base, issue)
+		}
+	}
+	return base
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CheckResult is the outcome of validating a configuration file without loading it
+type CheckResult struct {
+	Errors   ValidationErrors `json:"errors,omitempty"`
+	Warnings []string         `json:"warnings,omitempty"`
+}
+
+// Check parses and validates the configuration file at configPath without
+// loading remote config or replacing the global configuration. A non-nil
+// error means the file could not be read or parsed at all.
+func Check(configPath string) (*CheckResult, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	_, warnings, err := decode(data)
+	result := &CheckResult{Warnings: warnings}
+	if err != nil {
+		var issues ValidationErrors
+		if !errors.As(err, &issues) {
+			return nil, err
+		}
+		result.Errors = issues
+	}
+	return result, nil
+}
@@ -0,0 +1,156 @@
+// Package consensus decides whether a service is offline from the
+// observations of several agents, so a single agent's network problems do
+// not take a service out of GeoDNS.
+package consensus
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Consensus states
+const (
+	StateUp   = "up"
+	StateDown = "down"
+)
+
+// Observation is one agent's view of one service, exchanged over NATS
+type Observation struct {
+	AgentID    string    `json:"agent_id"`
+	Region     string    `json:"region,omitempty"`
+	Service    string    `json:"service"`
+	Status     string    `json:"status"` // up, down
+	Error      string    `json:"error,omitempty"`
+	ObservedAt time.Time `json:"observed_at"`
+}
+
+// Vote is an observation as received by this agent
+type Vote struct {
+	Observation
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// Result is the consensus about a service together with the votes it was
+// derived from
+type Result struct {
+	Service         string    `json:"service"`
+	State           string    `json:"state"`
+	Quorum          int       `json:"quorum"`
+	DownVotes       int       `json:"down_votes"`
+	DistinctRegions bool      `json:"distinct_regions"`
+	Window          string    `json:"window"`
+	EvaluatedAt     time.Time `json:"evaluated_at"`
+	Votes           []Vote    `json:"votes"`
+}
+
+// Tracker keeps the latest observation per service and agent
+type Tracker struct {
+	quorum          int
+	window          time.Duration
+	distinctRegions bool
+
+	mu     sync.Mutex
+	votes  map[string]map[string]Vote // service -> agent -> vote
+	states map[string]string          // service -> last evaluated state
+}
+
+// NewTracker creates a tracker that declares a service down once quorum
+// agents (or regions, if distinctRegions) reported it down within window
+func NewTracker(quorum int, window time.Duration, distinctRegions bool) *Tracker {
+	if quorum < 1 {
+		quorum = 1
+	}
+	return &Tracker{
+		quorum:          quorum,
+		window:          window,
+		distinctRegions: distinctRegions,
+		votes:           make(map[string]map[string]Vote),
+		states:          make(map[string]string),
+	}
+}
+
+// Observe records an observation received at receivedAt, replacing the
+// previous one from the same agent for the same service. The window is
+// measured from receivedAt, so a peer with a skewed clock cannot keep a
+// vote alive or have it expire early.
+func (t *Tracker) Observe(obs Observation, receivedAt time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	byAgent, ok := t.votes[obs.Service]
+	if !ok {
+		byAgent = make(map[string]Vote)
+		t.votes[obs.Service] = byAgent
+	}
+	// ObservedAt only orders observations from the same agent's clock
+	if previous, ok := byAgent[obs.AgentID]; ok && previous.ObservedAt.After(obs.ObservedAt) {
+		return
+	}
+	byAgent[obs.AgentID] = Vote{Observation: obs, ReceivedAt: receivedAt}
+}
+
+// Evaluate computes the consensus for service at now, considering only
+// votes received inside the window. With distinctRegions, down votes count
+// once per region and votes without a region do not count. changed reports
+// whether the state differs from the previous evaluation; the first
+// evaluation of a service only counts as a change if it is down.
+func (t *Tracker) Evaluate(service string, now time.Time) (result Result, changed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result = Result{
+		Service:         service,
+		State:           StateUp,
+		Quorum:          t.quorum,
+		DistinctRegions: t.distinctRegions,
+		Window:          t.window.String(),
+		EvaluatedAt:     now,
+		Votes:           []Vote{},
+	}
+
+	downVoters := make(map[string]bool)
+	for agentID, vote := range t.votes[service] {
+		if now.Sub(vote.ReceivedAt) > t.window {
+			delete(t.votes[service], agentID)
+			continue
+		}
+		result.Votes = append(result.Votes, vote)
+		if vote.Status != StateDown {
+			continue
+		}
+		voter := vote.AgentID
+		if t.distinctRegions {
+			if vote.Region == "" {
+				// Region-less agents could otherwise reach quorum on their own
+				continue
+			}
+			voter = vote.Region
+		}
+		downVoters[voter] = true
+	}
+	sort.Slice(result.Votes, func(i, j int) bool { return result.Votes[i].AgentID < result.Votes[j].AgentID })
+
+	result.DownVotes = len(downVoters)
+	if result.DownVotes >= t.quorum {
+		result.State = StateDown
+	}
+
+	previous, known := t.states[service]
+	t.states[service] = result.State
+	if !known {
+		return result, result.State == StateDown
+	}
+	return result, previous != result.State
+}
+
+// State returns the last evaluated consensus state of service, or StateUp if
+// it has not been evaluated
+func (t *Tracker) State(service string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if state, ok := t.states[service]; ok {
+		return state
+	}
+	return StateUp
+}
@@ -0,0 +1,147 @@
+package consensus
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := time.Minute
+
+	type vote struct {
+		agent, region, status string
+		received              time.Duration // before now
+		observed              time.Duration // before now; defaults to received
+	}
+	tests := []struct {
+		name            string
+		quorum          int
+		distinctRegions bool
+		votes           []vote
+		state           string
+		downVotes       int
+		counted         int // votes inside the window
+	}{
+		{"no votes", 2, false, nil, StateUp, 0, 0},
+		{"below quorum", 2, false, []vote{
+			{"a", "", StateDown, 0, 0},
+			{"b", "", StateUp, 0, 0},
+		}, StateUp, 1, 2},
+		{"quorum reached", 2, false, []vote{
+			{"a", "", StateDown, 0, 0},
+			{"b", "", StateDown, 10 * time.Second, 0},
+		}, StateDown, 2, 2},
+		{"quorum below one counts as one", 0, false, []vote{
+			{"a", "", StateDown, 0, 0},
+		}, StateDown, 1, 1},
+		{"expired votes are dropped", 2, false, []vote{
+			{"a", "", StateDown, 0, 0},
+			{"b", "", StateDown, 2 * time.Minute, 0},
+		}, StateUp, 1, 1},
+		{"window uses receive time, not the peer clock", 2, false, []vote{
+			{"a", "", StateDown, 0, 0},
+			{"b", "", StateDown, 0, 10 * time.Minute},
+		}, StateDown, 2, 2},
+		{"future peer clock does not extend a vote", 2, false, []vote{
+			{"a", "", StateDown, 0, 0},
+			{"b", "", StateDown, 2 * time.Minute, -time.Hour},
+		}, StateUp, 1, 1},
+		{"one region counts once", 2, true, []vote{
+			{"a", "eu", StateDown, 0, 0},
+			{"b", "eu", StateDown, 0, 0},
+		}, StateUp, 1, 2},
+		{"distinct regions reach quorum", 2, true, []vote{
+			{"a", "eu", StateDown, 0, 0},
+			{"b", "us", StateDown, 0, 0},
+		}, StateDown, 2, 2},
+		{"region-less votes do not count in region mode", 2, true, []vote{
+			{"a", "", StateDown, 0, 0},
+			{"b", "", StateDown, 0, 0},
+			{"c", "", StateDown, 0, 0},
+		}, StateUp, 0, 3},
+		{"region-less votes count per agent otherwise", 2, false, []vote{
+			{"a", "", StateDown, 0, 0},
+			{"b", "", StateDown, 0, 0},
+		}, StateDown, 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker(tt.quorum, window, tt.distinctRegions)
+			for _, v := range tt.votes {
+				observed := v.observed
+				if observed == 0 {
+					observed = v.received
+				}
+				tracker.Observe(Observation{
+					AgentID:    v.agent,
+					Region:     v.region,
+					Service:    "rpc",
+					Status:     v.status,
+					ObservedAt: now.Add(-observed),
+				}, now.Add(-v.received))
+			}
+
+			result, _ := tracker.Evaluate("rpc", now)
+			if result.State != tt.state {
+				t.Errorf("state = %s, want %s", result.State, tt.state)
+			}
+			if result.DownVotes != tt.downVotes {
+				t.Errorf("down votes = %d, want %d", result.DownVotes, tt.downVotes)
+			}
+			if len(result.Votes) != tt.counted {
+				t.Errorf("votes = %d, want %d", len(result.Votes), tt.counted)
+			}
+		})
+	}
+}
+
+func TestEvaluateChanges(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(1, time.Minute, false)
+	observe := func(status string, at time.Time) {
+		tracker.Observe(Observation{AgentID: "a", Service: "rpc", Status: status, ObservedAt: at}, at)
+	}
+
+	steps := []struct {
+		status  string
+		at      time.Duration
+		state   string
+		changed bool
+	}{
+		{StateUp, 0, StateUp, false}, // first evaluation only changes if down
+		{StateUp, time.Second, StateUp, false},
+		{StateDown, 2 * time.Second, StateDown, true},
+		{StateDown, 3 * time.Second, StateDown, false},
+		{StateUp, 4 * time.Second, StateUp, true},
+	}
+	for i, step := range steps {
+		observe(step.status, now.Add(step.at))
+		result, changed := tracker.Evaluate("rpc", now.Add(step.at))
+		if result.State != step.state || changed != step.changed {
+			t.Errorf("step %d: state %s changed %v, want %s %v", i, result.State, changed, step.state, step.changed)
+		}
+		if got := tracker.State("rpc"); got != step.state {
+			t.Errorf("step %d: State = %s, want %s", i, got, step.state)
+		}
+	}
+
+	if got := tracker.State("unknown"); got != StateUp {
+		t.Errorf("State of an unknown service = %s, want up", got)
+	}
+}
+
+func TestObserveKeepsNewest(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(1, time.Minute, false)
+
+	tracker.Observe(Observation{AgentID: "a", Service: "rpc", Status: StateDown, ObservedAt: now}, now)
+	// An older observation delivered late does not replace the newer one
+	tracker.Observe(Observation{AgentID: "a", Service: "rpc", Status: StateUp, ObservedAt: now.Add(-time.Second)}, now)
+
+	result, _ := tracker.Evaluate("rpc", now)
+	if result.State != StateDown || len(result.Votes) != 1 {
+		t.Errorf("got state %s with %d votes, want down with 1", result.State, len(result.Votes))
+	}
+}
@@ -0,0 +1,425 @@
+// Package database writes check results, state changes and incidents to
+// MySQL or MariaDB.
+//
+// Records are queued in memory and written in batches by a single goroutine,
+// so a slow or unreachable database never blocks the caller. A batch that
+// fails is kept and retried with exponential backoff while new records keep
+// queueing; once the queue is full new records are dropped and counted. The
+// schema is created and migrated on the first successful connection.
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/incidents"
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+)
+
+const (
+	minRetryDelay = time.Second
+	maxRetryDelay = time.Minute
+
+	// writeTimeout bounds a migration or a batch write
+	writeTimeout = 30 * time.Second
+)
+
+func init() {
+	// The sink reports failed writes itself; keep the driver's own
+	// connection errors out of stderr
+	_ = mysql.SetLogger(driverLogger{})
+}
+
+// driverLogger logs driver messages at debug level
+type driverLogger struct{}
+
+func (driverLogger) Print(v ...interface{}) {
+	logging.Debug("MySQL driver", "message", fmt.Sprint(v...))
+}
+
+// Result is a single check result
+type Result struct {
+	Service   string
+	Status    string
+	Consensus string
+	LatencyMs float64
+	Error     string
+	CheckedAt time.Time
+}
+
+// Stats describes the state of the sink
+type Stats struct {
+	Connected     bool       `json:"connected"` // the last write succeeded
+	SchemaVersion int        `json:"schema_version"`
+	Queued        int64      `json:"queued"`
+	Written       uint64     `json:"written"`
+	Dropped       uint64     `json:"dropped"` // records discarded because the queue was full
+	Failures      uint64     `json:"failures"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastWrite     *time.Time `json:"last_write,omitempty"`
+}
+
+// record is a queued result or state change
+type record struct {
+	result *Result
+	change *incidents.Change
+}
+
+// Sink writes records to MySQL in the background
+type Sink struct {
+	db            *sql.DB
+	agentID       string
+	batchSize     int
+	queueSize     int64
+	flushInterval time.Duration
+
+	queue chan record
+
+	// ctx ends in-flight writes when Close gives up; closeCtx bounds the
+	// final write once stop is closed
+	ctx       context.Context
+	cancel    context.CancelFunc
+	closeCtx  context.Context
+	closeOnce sync.Once
+	stop      chan struct{}
+	done      chan struct{}
+
+	queued        atomic.Int64
+	written       atomic.Uint64
+	dropped       atomic.Uint64
+	failures      atomic.Uint64
+	schemaVersion atomic.Int64
+
+	mu        sync.Mutex
+	connected bool
+	lastError string
+	lastWrite time.Time
+}
+
+// Open starts a sink writing to the database described by cfg, tagging rows
+// with agentID. It does not wait for the database to be reachable.
+func Open(cfg config.MysqlConfig, agentID string) (*Sink, error) {
+	dsn := mysql.NewConfig()
+	dsn.User = cfg.User
+	dsn.Passwd = cfg.Pass
+	dsn.Net = "tcp"
+	dsn.Addr = net.JoinHostPort(cfg.Host, cfg.Port)
+	dsn.DBName = cfg.DB
+	dsn.Loc = time.UTC
+	dsn.ParseTime = true
+	dsn.Timeout = 5 * time.Second
+	dsn.ReadTimeout = writeTimeout
+	dsn.WriteTimeout = writeTimeout
+	// Multi-row inserts are sent as a single query instead of a prepared
+	// statement per batch shape
+	dsn.InterpolateParams = true
+
+	db, err := sql.Open("mysql", dsn.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MySQL connection: %w", err)
+	}
+	db.SetMaxOpenConns(2)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	s := newSink(db, agentID, cfg.BatchSize, cfg.QueueSize, time.Duration(cfg.FlushInterval)*time.Second)
+	go s.run()
+	return s, nil
+}
+
+// newSink creates a sink writing to db; run must be started by the caller
+func newSink(db *sql.DB, agentID string, batchSize, queueSize int, flushInterval time.Duration) *Sink {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Sink{
+		db:            db,
+		agentID:       agentID,
+		batchSize:     batchSize,
+		queueSize:     int64(queueSize),
+		flushInterval: flushInterval,
+		queue:         make(chan record, queueSize),
+		ctx:           ctx,
+		cancel:        cancel,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// RecordResult queues a check result. It never blocks; false means the
+// queue was full and the result was dropped.
+func (s *Sink) RecordResult(r Result) bool {
+	return s.enqueue(record{result: &r})
+}
+
+// RecordChange queues a state change and the incident it opened or
+// resolved. It never blocks; false means the queue was full and the change
+// was dropped.
+func (s *Sink) RecordChange(c incidents.Change) bool {
+	return s.enqueue(record{change: &c})
+}
+
+func (s *Sink) enqueue(r record) bool {
+	if s.queued.Add(1) > s.queueSize {
+		s.queued.Add(-1)
+		s.dropped.Add(1)
+		return false
+	}
+	s.queue <- r
+	return true
+}
+
+// Stats returns the current state of the sink
+func (s *Sink) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := Stats{
+		Connected:     s.connected,
+		SchemaVersion: int(s.schemaVersion.Load()),
+		Queued:        s.queued.Load(),
+		Written:       s.written.Load(),
+		Dropped:       s.dropped.Load(),
+		Failures:      s.failures.Load(),
+		LastError:     s.lastError,
+	}
+	if !s.lastWrite.IsZero() {
+		lastWrite := s.lastWrite
+		stats.LastWrite = &lastWrite
+	}
+	return stats
+}
+
+// Close writes the queued records, giving up when ctx ends, and closes the
+// connection
+func (s *Sink) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		s.closeCtx = ctx
+		close(s.stop)
+	})
+	select {
+	case <-s.done:
+	case <-ctx.Done():
+		s.cancel()
+		<-s.done
+	}
+	s.cancel()
+
+	var err error
+	if n := s.queued.Load(); n > 0 {
+		err = fmt.Errorf("%d records not written to MySQL", n)
+	}
+	if closeErr := s.db.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("failed to close MySQL connection: %w", closeErr)
+	}
+	return err
+}
+
+// run writes queued records every flushInterval or whenever a full batch is
+// waiting, retrying failed writes with backoff
+func (s *Sink) run() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.flushInterval)
+	defer ticker.Stop()
+
+	var (
+		pending []record
+		retryAt time.Time
+		delay   = minRetryDelay
+	)
+	flush := func(ctx context.Context) {
+		n, err := s.write(ctx, pending)
+		pending = append(pending[:0], pending[n:]...)
+		s.queued.Add(-int64(n))
+		if err != nil {
+			s.failed(err)
+			retryAt = time.Now().Add(delay)
+			delay = min(2*delay, maxRetryDelay)
+			return
+		}
+		s.succeeded()
+		retryAt = time.Time{}
+		delay = minRetryDelay
+	}
+	timedFlush := func() {
+		if time.Now().Before(retryAt) {
+			return
+		}
+		ctx, cancel := context.WithTimeout(s.ctx, writeTimeout)
+		defer cancel()
+		flush(ctx)
+	}
+
+	// Migrate before the first records arrive
+	timedFlush()
+	for {
+		select {
+		case <-s.stop:
+		drain:
+			for {
+				select {
+				case r := <-s.queue:
+					pending = append(pending, r)
+				default:
+					break drain
+				}
+			}
+			if len(pending) > 0 {
+				flush(s.closeCtx)
+			}
+			return
+		case r := <-s.queue:
+			pending = append(pending, r)
+			if len(pending) >= s.batchSize {
+				timedFlush()
+			}
+		case <-ticker.C:
+			if len(pending) > 0 || s.schemaVersion.Load() == 0 {
+				timedFlush()
+			}
+		}
+	}
+}
+
+// failed records a failed write
+func (s *Sink) failed(err error) {
+	s.failures.Add(1)
+
+	s.mu.Lock()
+	wasConnected := s.connected || s.lastError == ""
+	s.connected = false
+	s.lastError = err.Error()
+	s.mu.Unlock()
+
+	if wasConnected {
+		logging.Warn("MySQL unavailable; queueing records", "error", err, "queued", s.queued.Load())
+	} else {
+		logging.Debug("MySQL write failed", "error", err, "queued", s.queued.Load())
+	}
+}
+
+// succeeded records a successful write
+func (s *Sink) succeeded() {
+	s.mu.Lock()
+	recovered := !s.connected && s.lastError != ""
+	s.connected = true
+	s.lastError = ""
+	s.lastWrite = time.Now()
+	s.mu.Unlock()
+
+	if recovered {
+		logging.Info("MySQL available again")
+	}
+}
+
+// write migrates the schema if needed and writes records in batches of
+// batchSize, each in its own transaction. It returns how many records were
+// written before any error.
+func (s *Sink) write(ctx context.Context, records []record) (int, error) {
+	if err := s.migrate(ctx); err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for len(records) > 0 {
+		n := min(len(records), s.batchSize)
+		if err := s.writeBatch(ctx, records[:n]); err != nil {
+			return written, err
+		}
+		s.written.Add(uint64(n))
+		written += n
+		records = records[n:]
+	}
+	return written, nil
+}
+
+// writeBatch writes records in one transaction. Rows already written by an
+// earlier attempt whose outcome was unknown are left as they are.
+func (s *Sink) writeBatch(ctx context.Context, records []record) error {
+	var results, changes, incidentRows insert
+	results.init("check_results", "agent_id, service, status, consensus, latency_ms, error, checked_at", "id = id")
+	changes.init("state_changes", "agent_id, service, from_status, to_status, error, incident_id, changed_at", "id = id")
+	incidentRows.init("incidents", "id, agent_id, service, started_at, resolved_at, error", "resolved_at = VALUES(resolved_at)")
+
+	for _, r := range records {
+		switch {
+		case r.result != nil:
+			res := r.result
+			results.add(s.agentID, res.Service, res.Status, res.Consensus, res.LatencyMs, nullString(res.Error), res.CheckedAt.UTC())
+		case r.change != nil:
+			c := r.change
+			var incidentID sql.NullString
+			if c.Incident != nil {
+				inc := c.Incident
+				incidentID = nullString(inc.ID)
+				var resolvedAt sql.NullTime
+				if inc.ResolvedAt != nil {
+					resolvedAt = sql.NullTime{Time: inc.ResolvedAt.UTC(), Valid: true}
+				}
+				incidentRows.add(inc.ID, s.agentID, inc.Service, inc.StartedAt.UTC(), resolvedAt, nullString(inc.Error))
+			}
+			changes.add(s.agentID, c.Service, c.From, c.To, nullString(c.Error), incidentID, c.At.UTC())
+		}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, ins := range []*insert{&results, &changes, &incidentRows} {
+		if err := ins.exec(ctx, tx); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %w", err)
+	}
+	return nil
+}
+
+// insert builds a multi-row INSERT ... ON DUPLICATE KEY UPDATE statement
+type insert struct {
+	table   string
+	columns string
+	onDup   string
+	row     string
+	rows    int
+	args    []interface{}
+}
+
+func (i *insert) init(table, columns, onDup string) {
+	i.table = table
+	i.columns = columns
+	i.onDup = onDup
+	i.row = "(" + strings.TrimSuffix(strings.Repeat("?, ", strings.Count(columns, ",")+1), ", ") + ")"
+}
+
+func (i *insert) add(args ...interface{}) {
+	i.rows++
+	i.args = append(i.args, args...)
+}
+
+func (i *insert) exec(ctx context.Context, tx *sql.Tx) error {
+	if i.rows == 0 {
+		return nil
+	}
+	rows := strings.TrimSuffix(strings.Repeat(i.row+", ", i.rows), ", ")
+	query := "INSERT INTO " + i.table + " (" + i.columns + ") VALUES " + rows + " ON DUPLICATE KEY UPDATE " + i.onDup
+	if _, err := tx.ExecContext(ctx, query, i.args...); err != nil {
+		return fmt.Errorf("failed to write %s: %w", i.table, err)
+	}
+	return nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,373 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/ibp-network/ibp-geodns-agent/src/incidents"
+)
+
+var checkedAt = time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// newMockSink returns a sink writing to a mock database. The run goroutine
+// is not started.
+func newMockSink(t *testing.T, batchSize, queueSize int) (*Sink, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return newSink(db, "agent-1", batchSize, queueSize, time.Hour), mock
+}
+
+// startMockSink returns a running sink with the schema already migrated
+func startMockSink(t *testing.T, batchSize, queueSize int, flushInterval time.Duration) (*Sink, sqlmock.Sqlmock) {
+	t.Helper()
+	s, mock := newMockSink(t, batchSize, queueSize)
+	s.flushInterval = flushInterval
+	s.schemaVersion.Store(int64(len(migrations)))
+	go s.run()
+	return s, mock
+}
+
+// exact matches query and nothing else
+func exact(query string) string {
+	return "^" + regexp.QuoteMeta(query) + "$"
+}
+
+// expectMigrate expects a migration run that finds the schema at version
+// from and applies the rest, failing migration failAt if it is not zero
+func expectMigrate(mock sqlmock.Sqlmock, from, failAt int) {
+	mock.ExpectQuery(exact("SELECT GET_LOCK(?, ?)")).WithArgs(migrationLock, int(writeTimeout.Seconds())).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(1))
+	mock.ExpectExec("^CREATE TABLE IF NOT EXISTS schema_migrations ").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(exact("SELECT COALESCE(MAX(version), 0) FROM schema_migrations")).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(from))
+	for v := from + 1; v <= len(migrations); v++ {
+		if v == failAt {
+			mock.ExpectExec(exact(migrations[v-1])).WillReturnError(errors.New("disk full"))
+			break
+		}
+		mock.ExpectExec(exact(migrations[v-1])).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(exact("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)")).
+			WithArgs(v, sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+	mock.ExpectQuery(exact("SELECT RELEASE_LOCK(?)")).WithArgs(migrationLock).
+		WillReturnRows(sqlmock.NewRows([]string{"released"}).AddRow(1))
+}
+
+// expectResults expects one transaction writing the check results of
+// services, failing with err if it is not nil
+func expectResults(mock sqlmock.Sqlmock, err error, services ...string) *sqlmock.ExpectedExec {
+	rows := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?), ", len(services)), ", ")
+	var args []driver.Value
+	for _, service := range services {
+		args = append(args, "agent-1", service, "up", "", 12.5, nil, checkedAt)
+	}
+
+	mock.ExpectBegin()
+	exec := mock.ExpectExec(exact("INSERT INTO check_results (agent_id, service, status, consensus, latency_ms, error, checked_at) VALUES " + rows + " ON DUPLICATE KEY UPDATE id = id")).
+		WithArgs(args...)
+	if err != nil {
+		exec.WillReturnError(err)
+		mock.ExpectRollback()
+		return exec
+	}
+	exec.WillReturnResult(sqlmock.NewResult(1, int64(len(services))))
+	mock.ExpectCommit()
+	return exec
+}
+
+func result(service string) Result {
+	return Result{Service: service, Status: "up", LatencyMs: 12.5, CheckedAt: checkedAt}
+}
+
+// waitFor polls cond until it holds or a few seconds pass
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    int
+		failAt  int
+		version int64 // schema version after the run; 0 if it failed
+	}{
+		{"empty database", 0, 0, int64(len(migrations))},
+		{"partly migrated", 1, 0, int64(len(migrations))},
+		{"up to date", len(migrations), 0, int64(len(migrations))},
+		{"newer agent migrated", len(migrations) + 1, 0, int64(len(migrations) + 1)},
+		{"migration fails", 0, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newMockSink(t, 10, 10)
+			expectMigrate(mock, tt.from, tt.failAt)
+
+			err := s.migrate(context.Background())
+			if (err != nil) != (tt.failAt != 0) {
+				t.Errorf("migrate: %v", err)
+			}
+			if got := s.schemaVersion.Load(); got != tt.version {
+				t.Errorf("schema version %d, want %d", got, tt.version)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMigrateResumesAfterRestart(t *testing.T) {
+	// The first agent records migration 1 and fails on migration 2
+	s, mock := newMockSink(t, 10, 10)
+	expectMigrate(mock, 0, 2)
+	if err := s.migrate(context.Background()); err == nil {
+		t.Fatal("migrate succeeded despite the failed migration")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a restart only migrations 2 onwards are applied; re-running
+	// migration 1 would be an unexpected query
+	s, mock = newMockSink(t, 10, 10)
+	expectMigrate(mock, 1, 0)
+	if err := s.migrate(context.Background()); err != nil {
+		t.Fatalf("migrate after restart: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+
+	// Once migrated the database is not asked again
+	if err := s.migrate(context.Background()); err != nil {
+		t.Errorf("second migrate: %v", err)
+	}
+}
+
+func TestMigrateLockTimeout(t *testing.T) {
+	s, mock := newMockSink(t, 10, 10)
+	mock.ExpectQuery(exact("SELECT GET_LOCK(?, ?)")).WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(0))
+
+	if err := s.migrate(context.Background()); err == nil {
+		t.Error("migrate succeeded without the lock")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	tests := []struct {
+		name  string
+		rows  [][]driver.Value
+		query string // empty if nothing is executed
+	}{
+		{"no rows", nil, ""},
+		{"one row", [][]driver.Value{{1, "a"}}, "INSERT INTO t (x, y) VALUES (?, ?) ON DUPLICATE KEY UPDATE y = VALUES(y)"},
+		{"several rows", [][]driver.Value{{1, "a"}, {2, "b"}, {3, "c"}},
+			"INSERT INTO t (x, y) VALUES (?, ?), (?, ?), (?, ?) ON DUPLICATE KEY UPDATE y = VALUES(y)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, mock := newMockSink(t, 10, 10)
+			var ins insert
+			ins.init("t", "x, y", "y = VALUES(y)")
+			var args []driver.Value
+			for _, row := range tt.rows {
+				ins.add(row[0], row[1])
+				args = append(args, row...)
+			}
+
+			mock.ExpectBegin()
+			if tt.query != "" {
+				mock.ExpectExec(exact(tt.query)).WithArgs(args...).WillReturnResult(sqlmock.NewResult(0, int64(len(tt.rows))))
+			}
+			tx, err := s.db.Begin()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer tx.Rollback()
+			if err := ins.exec(context.Background(), tx); err != nil {
+				t.Errorf("exec: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	s, mock := newMockSink(t, 10, 10)
+	resolvedAt := checkedAt.Add(time.Minute)
+	change := incidents.Change{
+		Service: "rpc",
+		From:    "down",
+		To:      "up",
+		At:      resolvedAt,
+		Incident: &incidents.Incident{
+			ID:         "0123456789abcdef0123456789abcdef",
+			Service:    "rpc",
+			StartedAt:  checkedAt,
+			ResolvedAt: &resolvedAt,
+			Error:      "timeout",
+		},
+	}
+	records := []record{
+		{result: &Result{Service: "rpc", Status: "down", Consensus: "down", LatencyMs: 0, Error: "timeout", CheckedAt: checkedAt}},
+		{change: &change},
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec("^INSERT INTO check_results ").
+		WithArgs("agent-1", "rpc", "down", "down", 0.0, "timeout", checkedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("^INSERT INTO state_changes ").
+		WithArgs("agent-1", "rpc", "down", "up", nil, change.Incident.ID, resolvedAt).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO incidents (id, agent_id, service, started_at, resolved_at, error) VALUES (?, ?, ?, ?, ?, ?) ON DUPLICATE KEY UPDATE resolved_at = VALUES(resolved_at)")).
+		WithArgs(change.Incident.ID, "agent-1", "rpc", checkedAt, resolvedAt, "timeout").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	if err := s.writeBatch(context.Background(), records); err != nil {
+		t.Errorf("writeBatch: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnqueueDropsWhenFull(t *testing.T) {
+	s, _ := newMockSink(t, 10, 2)
+
+	for i, want := range []bool{true, true, false, false} {
+		if got := s.RecordResult(result("rpc")); got != want {
+			t.Errorf("record %d queued = %v, want %v", i, got, want)
+		}
+	}
+	if got := s.RecordChange(incidents.Change{Service: "rpc"}); got {
+		t.Error("change queued on a full queue")
+	}
+
+	stats := s.Stats()
+	if stats.Queued != 2 || stats.Dropped != 3 {
+		t.Errorf("queued %d and dropped %d, want 2 and 3", stats.Queued, stats.Dropped)
+	}
+}
+
+func TestRunRetriesFailedBatch(t *testing.T) {
+	// Results queue up behind a failed batch, then go out in batches of one.
+	// The batches written before a failure are not written again.
+	s, mock := newMockSink(t, 1, 10)
+	s.flushInterval = 50 * time.Millisecond
+	s.schemaVersion.Store(int64(len(migrations)))
+	for _, service := range []string{"a", "b", "c"} {
+		s.RecordResult(result(service))
+	}
+
+	expectResults(mock, errors.New("connection reset"), "a")
+	expectResults(mock, nil, "a")
+	expectResults(mock, nil, "b")
+	expectResults(mock, errors.New("connection reset"), "c")
+	expectResults(mock, nil, "c")
+	mock.ExpectClose()
+
+	go s.run()
+	waitFor(t, "the failed batch to be written", func() bool {
+		stats := s.Stats()
+		return stats.Written == 2 && stats.Failures == 2
+	})
+	if queued := s.Stats().Queued; queued != 1 {
+		t.Errorf("%d records queued after the partial write, want 1", queued)
+	}
+	waitFor(t, "the retry", func() bool { return s.Stats().Written == 3 })
+
+	if err := s.Close(context.Background()); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	stats := s.Stats()
+	if stats.Queued != 0 || !stats.Connected || stats.LastError != "" {
+		t.Errorf("stats after recovery: %+v", stats)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunMigratesFirst(t *testing.T) {
+	s, mock := newMockSink(t, 10, 10)
+	s.flushInterval = 50 * time.Millisecond
+	expectMigrate(mock, 0, 0)
+	mock.ExpectClose()
+
+	go s.run()
+	waitFor(t, "the migration", func() bool { return s.Stats().SchemaVersion == len(migrations) })
+	if err := s.Close(context.Background()); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCloseFlushesQueue(t *testing.T) {
+	s, mock := startMockSink(t, 10, 10, time.Hour)
+	expectResults(mock, nil, "a", "b")
+	mock.ExpectClose()
+
+	s.RecordResult(result("a"))
+	s.RecordResult(result("b"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+	if written := s.Stats().Written; written != 2 {
+		t.Errorf("written %d, want 2", written)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCloseGivesUpAtDeadline(t *testing.T) {
+	s, mock := startMockSink(t, 10, 10, time.Hour)
+	// The transaction is rolled back either by database/sql when the
+	// context ends or by writeBatch, in no fixed order relative to Close
+	mock.MatchExpectationsInOrder(false)
+	expectResults(mock, errors.New("never returned"), "a", "b").WillDelayFor(time.Minute)
+	mock.ExpectClose()
+
+	s.RecordResult(result("a"))
+	s.RecordResult(result("b"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := s.Close(ctx)
+	if err == nil || !strings.Contains(err.Error(), "2 records not written") {
+		t.Errorf("Close = %v, want 2 records not written", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Close took %s with a 100ms deadline", elapsed)
+	}
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+)
+
+// migrationLock is the named lock held while migrating, so agents sharing a
+// database do not migrate it concurrently
+const migrationLock = "ibp_geodns_agent_schema"
+
+// migrations are applied in order; migration i brings the schema to
+// version i+1. Released migrations must never change.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS check_results (
+		id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		agent_id VARCHAR(191) NOT NULL,
+		service VARCHAR(191) NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		consensus VARCHAR(16) NOT NULL DEFAULT '',
+		latency_ms DOUBLE NOT NULL,
+		error TEXT NULL,
+		checked_at DATETIME(3) NOT NULL,
+		UNIQUE KEY check_results_sample (agent_id, service, checked_at),
+		KEY check_results_checked_at (checked_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+	`CREATE TABLE IF NOT EXISTS state_changes (
+		id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+		agent_id VARCHAR(191) NOT NULL,
+		service VARCHAR(191) NOT NULL,
+		from_status VARCHAR(16) NOT NULL,
+		to_status VARCHAR(16) NOT NULL,
+		error TEXT NULL,
+		incident_id CHAR(32) NULL,
+		changed_at DATETIME(3) NOT NULL,
+		UNIQUE KEY state_changes_change (agent_id, service, changed_at),
+		KEY state_changes_changed_at (changed_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+
+	`CREATE TABLE IF NOT EXISTS incidents (
+		id CHAR(32) NOT NULL PRIMARY KEY,
+		agent_id VARCHAR(191) NOT NULL,
+		service VARCHAR(191) NOT NULL,
+		started_at DATETIME(3) NOT NULL,
+		resolved_at DATETIME(3) NULL,
+		error TEXT NULL,
+		KEY incidents_service (agent_id, service, started_at)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`,
+}
+
+// migrate brings the schema up to date unless that has already been done
+func (s *Sink) migrate(ctx context.Context) error {
+	if s.schemaVersion.Load() >= int64(len(migrations)) {
+		return nil
+	}
+
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	var locked int
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLock, int(writeTimeout.Seconds())).Scan(&locked); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	if locked != 1 {
+		return errors.New("timed out waiting for another agent to migrate the schema")
+	}
+	defer func() {
+		var released int
+		_ = conn.QueryRowContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationLock).Scan(&released)
+	}()
+
+	_, err = conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT NOT NULL PRIMARY KEY,
+		applied_at DATETIME(3) NOT NULL
+	) ENGINE=InnoDB`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var version int
+	if err := conn.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+	if version > len(migrations) {
+		// A newer agent migrated the database. Migrations only add to the
+		// schema, so rows written by this agent still fit.
+		logging.Warn("MySQL schema is newer than this agent", "version", version, "supported", len(migrations))
+	}
+
+	// DDL commits implicitly in MySQL, so each migration is recorded after
+	// it succeeds and a failed one is retried from where it stopped
+	for v := version + 1; v <= len(migrations); v++ {
+		if _, err := conn.ExecContext(ctx, migrations[v-1]); err != nil {
+			return fmt.Errorf("failed to apply schema migration %d: %w", v, err)
+		}
+		if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", v, time.Now().UTC()); err != nil {
+			return fmt.Errorf("failed to record schema migration %d: %w", v, err)
+		}
+		logging.Info("Applied MySQL schema migration", "version", v)
+	}
+
+	s.schemaVersion.Store(int64(max(version, len(migrations))))
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package fleet tracks the other agents seen on the NATS bus.
+package fleet
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// forgetAfter is how long a lost peer stays listed before it is dropped
+const forgetAfter = 24 * time.Hour
+
+// Peer is what this agent knows about another agent from its reports
+type Peer struct {
+	AgentID   string    `json:"agent_id"`
+	Version   string    `json:"version,omitempty"`
+	Status    string    `json:"status"`
+	Services  int       `json:"services"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Lost      bool      `json:"lost"`
+}
+
+// Registry is a thread-safe set of peers keyed by AgentID
+type Registry struct {
+	threshold time.Duration
+
+	mu    sync.RWMutex
+	peers map[string]*Peer
+}
+
+// NewRegistry creates a registry that considers a peer lost once no report
+// has been seen from it for longer than threshold
+func NewRegistry(threshold time.Duration) *Registry {
+	return &Registry{
+		threshold: threshold,
+		peers:     make(map[string]*Peer),
+	}
+}
+
+// Threshold returns the duration after which a silent peer is considered lost
+func (r *Registry) Threshold() time.Duration {
+	return r.threshold
+}
+
+// Observe records a report from a peer received at the given time. It
+// returns the peer and whether it had previously been flagged as lost.
+func (r *Registry) Observe(agentID, version, status string, services int, at time.Time) (Peer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	peer, ok := r.peers[agentID]
+	if !ok {
+		peer = &Peer{AgentID: agentID, FirstSeen: at}
+		r.peers[agentID] = peer
+	}
+
+	recovered := peer.Lost
+	peer.Version = version
+	peer.Status = status
+	peer.Services = services
+	peer.LastSeen = at
+	peer.Lost = false
+
+	return *peer, recovered
+}
+
+// statusOffline is the report status of an agent that shut down gracefully
+const statusOffline = "offline"
+
+// Sweep flags peers not seen for longer than the threshold and returns the
+// ones that became lost during this call. Peers that announced a shutdown
+// are not flagged. Peers silent for longer than a day are forgotten.
+func (r *Registry) Sweep(now time.Time) []Peer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lost []Peer
+	for id, peer := range r.peers {
+		silent := now.Sub(peer.LastSeen)
+		switch {
+		case (peer.Lost || peer.Status == statusOffline) && silent > forgetAfter:
+			delete(r.peers, id)
+		case !peer.Lost && peer.Status != statusOffline && silent > r.threshold:
+			peer.Lost = true
+			lost = append(lost, *peer)
+		}
+	}
+
+	sortPeers(lost)
+	return lost
+}
+
+// Peer returns what is known about a single peer
+func (r *Registry) Peer(agentID string) (Peer, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	peer, ok := r.peers[agentID]
+	if !ok {
+		return Peer{}, false
+	}
+	return *peer, true
+}
+
+// Peers returns a snapshot of all known peers sorted by AgentID
+func (r *Registry) Peers() []Peer {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	peers := make([]Peer, 0, len(r.peers))
+	for _, peer := range r.peers {
+		peers = append(peers, *peer)
+	}
+	sortPeers(peers)
+	return peers
+}
+
+func sortPeers(peers []Peer) {
+	sort.Slice(peers, func(i, j int) bool { return peers[i].AgentID < peers[j].AgentID })
+}
@@ -0,0 +1,68 @@
+package health
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// publicPaths are served without authentication
+var publicPaths = map[string]bool{
+	"/live": true,
+}
+
+// authenticated wraps next so that every request except publicPaths must
+// present either a configured bearer token or a verified client certificate
+func (s *Server) authenticated(next http.Handler) http.Handler {
+	if !s.cfg.AuthEnabled() {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if publicPaths[r.URL.Path] || s.authorize(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if len(s.cfg.AuthTokens) > 0 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ibp-geodns-agent"`)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("UNAUTHORIZED"))
+	})
+}
+
+// authorize reports whether r carries valid credentials
+func (s *Server) authorize(r *http.Request) bool {
+	if s.cfg.ClientCA != "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+
+	header := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+
+	valid := false
+	for _, candidate := range s.cfg.AuthTokens {
+		// Compare against every token so timing does not reveal which matched
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
+
+// Principal describes who made an authenticated request, for audit logs: the
+// client certificate subject for mTLS, "bearer-token" for token auth, or
+// "anonymous" followed by the remote address otherwise
+func Principal(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return "mtls:" + r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		return "bearer-token@" + r.RemoteAddr
+	}
+	return "anonymous@" + r.RemoteAddr
+}
@@ -0,0 +1,110 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Check evaluates a single condition; a non-nil error means it is not met
+type Check func() error
+
+// namedCheck is a Check registered under a name
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// ConditionResult is the outcome of one condition in a JSON breakdown
+type ConditionResult struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Breakdown is the JSON body returned by /health and /ready when requested
+type Breakdown struct {
+	Status     string                     `json:"status"`
+	Conditions map[string]ConditionResult `json:"conditions"`
+}
+
+// AddHealthCheck registers a condition that must hold for /health to
+// succeed, replacing any condition with the same name
+func (s *Server) AddHealthCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.healthChecks = setCheck(s.healthChecks, name, check)
+}
+
+// AddReadinessCheck registers a condition that must hold for /ready to
+// succeed, replacing any condition with the same name
+func (s *Server) AddReadinessCheck(name string, check Check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readyChecks = setCheck(s.readyChecks, name, check)
+}
+
+func setCheck(checks []namedCheck, name string, check Check) []namedCheck {
+	for i := range checks {
+		if checks[i].name == name {
+			checks[i].check = check
+			return checks
+		}
+	}
+	return append(checks, namedCheck{name: name, check: check})
+}
+
+// evaluate runs every check and reports whether all of them passed. flagName
+// and flag describe the manual SetHealthy/SetReady override, which counts as
+// a condition of its own.
+func evaluate(flagName string, flag bool, checks []namedCheck) (bool, map[string]ConditionResult) {
+	results := make(map[string]ConditionResult, len(checks)+1)
+	ok := flag
+
+	results[flagName] = ConditionResult{OK: flag}
+	if !flag {
+		results[flagName] = ConditionResult{Error: "disabled by agent"}
+	}
+
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			ok = false
+			results[c.name] = ConditionResult{Error: err.Error()}
+			continue
+		}
+		results[c.name] = ConditionResult{OK: true}
+	}
+	return ok, results
+}
+
+// wantsJSON reports whether the client asked for a JSON breakdown, either via
+// ?format=json or an Accept header that prefers application/json
+func wantsJSON(r *http.Request) bool {
+	if r.URL.Query().Get("format") == "json" {
+		return true
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// writeCondition writes the result of a /health or /ready evaluation
+func writeCondition(w http.ResponseWriter, r *http.Request, ok bool, okText, failText string, results map[string]ConditionResult) {
+	code := http.StatusOK
+	text := okText
+	if !ok {
+		code = http.StatusServiceUnavailable
+		text = failText
+	}
+
+	if !wantsJSON(r) {
+		w.WriteHeader(code)
+		w.Write([]byte(text))
+		return
+	}
+
+	data, _ := json.Marshal(Breakdown{
+		Status:     strings.ToLower(strings.ReplaceAll(text, " ", "_")),
+		Conditions: results,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(data)
+}
@@ -2,28 +2,47 @@ package health
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
 	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/metrics"
+	"github.com/ibp-network/ibp-geodns-agent/src/schema"
 )
 
+// StatusProvider returns the payload served as JSON by /status
+type StatusProvider func() interface{}
+
 // Server provides health check endpoints
 type Server struct {
-	port     int
-	server   *http.Server
-	mu       sync.RWMutex
-	healthy  bool
-	ready    bool
-	started  bool
+	port    int
+	cfg     config.HealthServerConfig
+	server  *http.Server
+	mu      sync.RWMutex
+	healthy bool
+	ready   bool
+	started bool
+	status  StatusProvider
+
+	healthChecks []namedCheck
+	readyChecks  []namedCheck
+	routes       map[string]http.Handler
+	adminRoutes  map[string]http.Handler
 }
 
 // New creates a new health server
-func New(port int) *Server {
+func New(port int, cfg config.HealthServerConfig) *Server {
 	return &Server{
 		port:    port,
+		cfg:     cfg,
 		healthy: true,
 		ready:   false,
 	}
@@ -42,15 +61,37 @@ func (s *Server) Start() error {
 	mux.HandleFunc("/health", s.healthHandler)
 	mux.HandleFunc("/ready", s.readyHandler)
 	mux.HandleFunc("/live", s.liveHandler)
+	mux.HandleFunc("/status", s.statusHandler)
+	mux.HandleFunc("/metrics", s.metricsHandler)
+	mux.HandleFunc("/schema/", s.schemaHandler)
+	for pattern, handler := range s.routes {
+		mux.Handle(pattern, handler)
+	}
+	for pattern, handler := range s.adminRoutes {
+		if !s.cfg.AuthEnabled() {
+			handler = http.HandlerFunc(adminDisabledHandler)
+		}
+		mux.Handle(pattern, handler)
+	}
 
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: mux,
+		Addr:              net.JoinHostPort(s.cfg.BindAddress, strconv.Itoa(s.port)),
+		Handler:           s.authenticated(mux),
+		ReadHeaderTimeout: 10 * time.Second,
 	}
+
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+
 	listener, err := net.Listen("tcp", s.server.Addr)
 	if err != nil {
 		return fmt.Errorf("failed to listen on health port %d: %w", s.port, err)
 	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
 
 	go func() {
 		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
@@ -59,7 +100,10 @@ func (s *Server) Start() error {
 	}()
 
 	s.started = true
-	logging.Info("Health server started", "port", s.port)
+	logging.Info("Health server started", "addr", s.server.Addr, "tls", tlsConfig != nil, "auth", s.cfg.AuthEnabled())
+	if !s.cfg.AuthEnabled() && !isLoopback(s.cfg.BindAddress) {
+		logging.Warn("Health server is reachable without authentication; /status exposes internal topology", "addr", s.server.Addr)
+	}
 
 	return nil
 }
@@ -84,6 +128,42 @@ func (s *Server) Stop(ctx context.Context) error {
 	return nil
 }
 
+// tlsConfig returns the TLS configuration for the listener, or nil when TLS is disabled
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if !s.cfg.TLSEnabled() {
+		return nil, nil
+	}
+
+	reloader, err := newCertReloader(s.cfg.TLSCert, s.cfg.TLSKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if s.cfg.ClientCA != "" {
+		pool, err := loadCertPool(s.cfg.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientCAs = pool
+		// Certificates are optional at the TLS layer so /live keeps working;
+		// the auth middleware requires them for every other endpoint
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+func isLoopback(addr string) bool {
+	if addr == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
 // SetHealthy sets the healthy status
 func (s *Server) SetHealthy(healthy bool) {
 	s.mu.Lock()
@@ -98,34 +178,58 @@ func (s *Server) SetReady(ready bool) {
 	s.ready = ready
 }
 
-// healthHandler handles /health endpoint
+// Handle registers an endpoint served with the same access control as
+// /status. Routes must be registered before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.routes == nil {
+		s.routes = make(map[string]http.Handler)
+	}
+	s.routes[pattern] = handler
+}
+
+// HandleAdmin registers an admin endpoint. Admin endpoints are only served
+// when authentication is configured; otherwise they answer 403. Routes must
+// be registered before Start.
+func (s *Server) HandleAdmin(pattern string, handler http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.adminRoutes == nil {
+		s.adminRoutes = make(map[string]http.Handler)
+	}
+	s.adminRoutes[pattern] = handler
+}
+
+// SetStatusProvider sets the function whose result is served as JSON by /status
+func (s *Server) SetStatusProvider(provider StatusProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = provider
+}
+
+// healthHandler handles /health endpoint. The agent is healthy while the
+// healthy flag is set and every registered health check passes.
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	s.mu.RLock()
 	healthy := s.healthy
+	checks := append([]namedCheck(nil), s.healthChecks...)
 	s.mu.RUnlock()
 
-	if healthy {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("OK"))
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte("UNHEALTHY"))
-	}
+	ok, results := evaluate("healthy", healthy, checks)
+	writeCondition(w, r, ok, "OK", "UNHEALTHY", results)
 }
 
-// readyHandler handles /ready endpoint
+// readyHandler handles /ready endpoint. The agent is ready while the ready
+// flag is set and every registered readiness check passes.
 func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
 	s.mu.RLock()
 	ready := s.ready
+	checks := append([]namedCheck(nil), s.readyChecks...)
 	s.mu.RUnlock()
 
-	if ready {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("READY"))
-	} else {
-		w.WriteHeader(http.StatusServiceUnavailable)
-		w.Write([]byte("NOT READY"))
-	}
+	ok, results := evaluate("started", ready, checks)
+	writeCondition(w, r, ok, "READY", "NOT READY", results)
 }
 
 // liveHandler handles /live endpoint (liveness probe)
@@ -134,3 +238,56 @@ func (s *Server) liveHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("ALIVE"))
 }
+
+// statusHandler handles /status endpoint
+func (s *Server) statusHandler(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	provider := s.status
+	s.mu.RUnlock()
+
+	if provider == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("STATUS UNAVAILABLE"))
+		return
+	}
+
+	data, err := json.MarshalIndent(provider(), "", "  ")
+	if err != nil {
+		logging.Error("Failed to marshal status", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// adminDisabledHandler answers admin requests when no authentication is configured
+func adminDisabledHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusForbidden)
+	w.Write([]byte("ADMIN API DISABLED: configure Agent.HealthServer.AuthTokens or ClientCA"))
+}
+
+// metricsHandler handles /metrics endpoint (Prometheus text format)
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := metrics.Write(w); err != nil {
+		logging.Debug("Failed to write metrics", "error", err)
+	}
+}
+
+// schemaHandler handles /schema/{config,report} and serves the embedded JSON Schemas
+func (s *Server) schemaHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/schema/"), ".json")
+	data, ok := schema.Lookup(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,330 @@
+// Package history stores check results on disk and downsamples them into
+// per-minute and per-hour rollups.
+//
+// Results and rollups live in a bbolt database, one bucket per resolution
+// holding one bucket per service, keyed by big-endian Unix time so range
+// queries and pruning are cursor scans. A result and the rollups it belongs
+// to are written in the same transaction, so a crash cannot leave them out
+// of step.
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Resolution selects raw results or a rollup interval
+type Resolution string
+
+// Resolutions kept by the store
+const (
+	Raw    Resolution = "raw"
+	Minute Resolution = "1m"
+	Hour   Resolution = "1h"
+)
+
+// MaxPoints bounds the number of results or rollups returned by one query
+const MaxPoints = 10000
+
+// ErrUnknownResolution is returned for resolutions other than raw, 1m and 1h
+var ErrUnknownResolution = errors.New("unknown resolution")
+
+// Result is a single check result
+type Result struct {
+	Time      time.Time `json:"time"`
+	Status    string    `json:"status"`
+	LatencyMs float64   `json:"latency_ms,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Rollup summarises the results of one service over a minute or an hour.
+// Degraded results count as available. Latencies are those of the checks
+// that were not down.
+type Rollup struct {
+	Start        time.Time `json:"start"`
+	Checks       uint64    `json:"checks"`
+	Up           uint64    `json:"up"`
+	Degraded     uint64    `json:"degraded"`
+	Down         uint64    `json:"down"`
+	Availability float64   `json:"availability"` // percent of checks not down
+	LatencyMinMs float64   `json:"latency_min_ms,omitempty"`
+	LatencyAvgMs float64   `json:"latency_avg_ms,omitempty"`
+	LatencyMaxMs float64   `json:"latency_max_ms,omitempty"`
+}
+
+// add counts r in the rollup
+func (s *Rollup) add(r Result) {
+	s.Checks++
+	switch r.Status {
+	case "down":
+		s.Down++
+	case "degraded":
+		s.Degraded++
+	default:
+		s.Up++
+	}
+	s.Availability = 100 * float64(s.Checks-s.Down) / float64(s.Checks)
+
+	if r.Status == "down" {
+		return
+	}
+	n := float64(s.Up + s.Degraded)
+	if n == 1 || r.LatencyMs < s.LatencyMinMs {
+		s.LatencyMinMs = r.LatencyMs
+	}
+	if r.LatencyMs > s.LatencyMaxMs {
+		s.LatencyMaxMs = r.LatencyMs
+	}
+	s.LatencyAvgMs += (r.LatencyMs - s.LatencyAvgMs) / n
+}
+
+// Retention is how long each resolution is kept
+type Retention struct {
+	Raw    time.Duration
+	Minute time.Duration
+	Hour   time.Duration
+}
+
+// Store is an on-disk history of check results
+type Store struct {
+	db *bolt.DB
+}
+
+// Open opens or creates the store at path. Only one process can hold it.
+func Open(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, res := range []Resolution{Raw, Minute, Hour} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(res)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialise history database: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the store
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record stores a check result of service and adds it to its minute and
+// hour rollups. Concurrent calls are committed together.
+func (s *Store) Record(service string, r Result) error {
+	r.Time = r.Time.UTC()
+	raw, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+
+	return s.db.Batch(func(tx *bolt.Tx) error {
+		b, err := serviceBucket(tx, Raw, service)
+		if err != nil {
+			return err
+		}
+		if err := b.Put(timeKey(r.Time, Raw), raw); err != nil {
+			return err
+		}
+
+		for _, res := range []Resolution{Minute, Hour} {
+			if err := addToRollup(tx, res, service, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// addToRollup adds r to the rollup of its interval at resolution res
+func addToRollup(tx *bolt.Tx, res Resolution, service string, r Result) error {
+	b, err := serviceBucket(tx, res, service)
+	if err != nil {
+		return err
+	}
+
+	start := r.Time.Truncate(interval(res))
+	key := timeKey(start, res)
+	rollup := Rollup{Start: start}
+	if data := b.Get(key); data != nil {
+		if err := json.Unmarshal(data, &rollup); err != nil {
+			return fmt.Errorf("corrupt %s rollup at %s: %w", res, start.Format(time.RFC3339), err)
+		}
+	}
+	rollup.add(r)
+
+	data, err := json.Marshal(rollup)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, data)
+}
+
+// Results returns the raw results of service between from and to, oldest
+// first, and whether more than MaxPoints matched
+func (s *Store) Results(service string, from, to time.Time) ([]Result, bool, error) {
+	var results []Result
+	truncated, err := s.scan(Raw, service, from, to, func(v []byte) error {
+		var r Result
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		results = append(results, r)
+		return nil
+	})
+	return results, truncated, err
+}
+
+// Rollups returns the rollups of service at resolution res that start
+// between from and to, oldest first, and whether more than MaxPoints matched.
+// The rollup of the current interval is included and still growing.
+func (s *Store) Rollups(service string, res Resolution, from, to time.Time) ([]Rollup, bool, error) {
+	if res != Minute && res != Hour {
+		return nil, false, fmt.Errorf("%w %q", ErrUnknownResolution, res)
+	}
+
+	var rollups []Rollup
+	truncated, err := s.scan(res, service, from.Truncate(interval(res)), to, func(v []byte) error {
+		var r Rollup
+		if err := json.Unmarshal(v, &r); err != nil {
+			return err
+		}
+		rollups = append(rollups, r)
+		return nil
+	})
+	return rollups, truncated, err
+}
+
+// Summary merges the hourly rollups of service since from into one
+func (s *Store) Summary(service string, from time.Time) (Rollup, error) {
+	rollups, _, err := s.Rollups(service, Hour, from, time.Now())
+	if err != nil {
+		return Rollup{}, err
+	}
+
+	summary := Rollup{Start: from.Truncate(time.Hour)}
+	var latencyWeight float64
+	for _, r := range rollups {
+		available := r.Up + r.Degraded
+		if available > 0 {
+			if latencyWeight == 0 || r.LatencyMinMs < summary.LatencyMinMs {
+				summary.LatencyMinMs = r.LatencyMinMs
+			}
+			if r.LatencyMaxMs > summary.LatencyMaxMs {
+				summary.LatencyMaxMs = r.LatencyMaxMs
+			}
+			latencyWeight += float64(available)
+			summary.LatencyAvgMs += (r.LatencyAvgMs - summary.LatencyAvgMs) * float64(available) / latencyWeight
+		}
+		summary.Checks += r.Checks
+		summary.Up += r.Up
+		summary.Degraded += r.Degraded
+		summary.Down += r.Down
+	}
+	if summary.Checks > 0 {
+		summary.Availability = 100 * float64(summary.Checks-summary.Down) / float64(summary.Checks)
+	}
+	return summary, nil
+}
+
+// scan calls fn with every value of service at resolution res keyed between
+// from and to, up to MaxPoints
+func (s *Store) scan(res Resolution, service string, from, to time.Time, fn func([]byte) error) (bool, error) {
+	truncated := false
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(res)).Bucket([]byte(service))
+		if b == nil {
+			return nil
+		}
+
+		end := timeKey(to, res)
+		c := b.Cursor()
+		n := 0
+		for k, v := c.Seek(timeKey(from, res)); k != nil && bytes.Compare(k, end) <= 0; k, v = c.Next() {
+			if n == MaxPoints {
+				truncated = true
+				return nil
+			}
+			if err := fn(v); err != nil {
+				return fmt.Errorf("corrupt %s entry: %w", res, err)
+			}
+			n++
+		}
+		return nil
+	})
+	return truncated, err
+}
+
+// Prune deletes results and rollups older than their retention and returns
+// how many entries were removed
+func (s *Store) Prune(now time.Time, retention Retention) (int, error) {
+	cutoffs := map[Resolution]time.Time{
+		Raw:    now.Add(-retention.Raw),
+		Minute: now.Add(-retention.Minute),
+		Hour:   now.Add(-retention.Hour),
+	}
+
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for res, cutoff := range cutoffs {
+			end := timeKey(cutoff, res)
+			err := tx.Bucket([]byte(res)).ForEachBucket(func(service []byte) error {
+				// Seek to the first key again after every delete; Next
+				// after Delete can skip an entry
+				c := tx.Bucket([]byte(res)).Bucket(service).Cursor()
+				for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.First() {
+					if err := c.Delete(); err != nil {
+						return err
+					}
+					removed++
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// serviceBucket returns the bucket of service at resolution res, creating it
+func serviceBucket(tx *bolt.Tx, res Resolution, service string) (*bolt.Bucket, error) {
+	return tx.Bucket([]byte(res)).CreateBucketIfNotExists([]byte(service))
+}
+
+// interval returns the length of a rollup interval
+func interval(res Resolution) time.Duration {
+	if res == Hour {
+		return time.Hour
+	}
+	return time.Minute
+}
+
+// timeKey encodes t so keys sort chronologically: Unix nanoseconds for raw
+// results, Unix seconds for rollups
+func timeKey(t time.Time, res Resolution) []byte {
+	n := t.Unix()
+	if res == Raw {
+		n = t.UnixNano()
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(n))
+	return key
+}
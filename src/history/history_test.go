@@ -0,0 +1,238 @@
+package history
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestStore opens a store in a temporary directory
+func openTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "history.db"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// record stores results of service, failing the test on error
+func record(t *testing.T, s *Store, service string, results ...Result) {
+	t.Helper()
+	for _, r := range results {
+		if err := s.Record(service, r); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+}
+
+func TestRollupAdd(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []Result
+		want    Rollup
+	}{
+		{"single up", []Result{{Status: "up", LatencyMs: 20}},
+			Rollup{Checks: 1, Up: 1, Availability: 100, LatencyMinMs: 20, LatencyAvgMs: 20, LatencyMaxMs: 20}},
+		{"degraded counts as available", []Result{{Status: "up", LatencyMs: 10}, {Status: "degraded", LatencyMs: 30}},
+			Rollup{Checks: 2, Up: 1, Degraded: 1, Availability: 100, LatencyMinMs: 10, LatencyAvgMs: 20, LatencyMaxMs: 30}},
+		{"down latency is ignored", []Result{{Status: "up", LatencyMs: 10}, {Status: "down", LatencyMs: 5000}},
+			Rollup{Checks: 2, Up: 1, Down: 1, Availability: 50, LatencyMinMs: 10, LatencyAvgMs: 10, LatencyMaxMs: 10}},
+		{"down first does not pin the minimum", []Result{{Status: "down"}, {Status: "up", LatencyMs: 40}, {Status: "up", LatencyMs: 20}, {Status: "down"}},
+			Rollup{Checks: 4, Up: 2, Down: 2, Availability: 50, LatencyMinMs: 20, LatencyAvgMs: 30, LatencyMaxMs: 40}},
+		{"all down", []Result{{Status: "down"}, {Status: "down"}},
+			Rollup{Checks: 2, Down: 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Rollup
+			for _, r := range tt.results {
+				got.add(r)
+			}
+			if got != tt.want {
+				t.Errorf("rollup = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordRollups(t *testing.T) {
+	s := openTestStore(t)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	record(t, s, "rpc",
+		Result{Time: start.Add(10 * time.Second), Status: "up", LatencyMs: 10},
+		Result{Time: start.Add(50 * time.Second), Status: "down"},
+		Result{Time: start.Add(70 * time.Second), Status: "up", LatencyMs: 30},
+		Result{Time: start.Add(time.Hour), Status: "up", LatencyMs: 50},
+	)
+	record(t, s, "other", Result{Time: start, Status: "down"})
+
+	tests := []struct {
+		name     string
+		res      Resolution
+		from, to time.Time
+		want     []Rollup
+	}{
+		{"minutes", Minute, start, start.Add(2 * time.Minute), []Rollup{
+			{Start: start, Checks: 2, Up: 1, Down: 1, Availability: 50, LatencyMinMs: 10, LatencyAvgMs: 10, LatencyMaxMs: 10},
+			{Start: start.Add(time.Minute), Checks: 1, Up: 1, Availability: 100, LatencyMinMs: 30, LatencyAvgMs: 30, LatencyMaxMs: 30},
+		}},
+		{"from inside an interval includes it", Minute, start.Add(30 * time.Second), start.Add(30 * time.Second), []Rollup{
+			{Start: start, Checks: 2, Up: 1, Down: 1, Availability: 50, LatencyMinMs: 10, LatencyAvgMs: 10, LatencyMaxMs: 10},
+		}},
+		{"hours", Hour, start, start.Add(time.Hour), []Rollup{
+			{Start: start, Checks: 3, Up: 2, Down: 1, Availability: 100 * 2.0 / 3, LatencyMinMs: 10, LatencyAvgMs: 20, LatencyMaxMs: 30},
+			{Start: start.Add(time.Hour), Checks: 1, Up: 1, Availability: 100, LatencyMinMs: 50, LatencyAvgMs: 50, LatencyMaxMs: 50},
+		}},
+		{"unknown service", Hour, start, start.Add(time.Hour), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := "rpc"
+			if tt.want == nil {
+				service = "unknown"
+			}
+			got, truncated, err := s.Rollups(service, tt.res, tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("Rollups: %v", err)
+			}
+			if truncated {
+				t.Error("rollups truncated")
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rollups, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if !got[i].Start.Equal(tt.want[i].Start) {
+					t.Errorf("rollup %d starts at %s, want %s", i, got[i].Start, tt.want[i].Start)
+				}
+				got[i].Start = tt.want[i].Start
+				if got[i] != tt.want[i] {
+					t.Errorf("rollup %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, _, err := s.Rollups("rpc", Raw, start, start); !errors.Is(err, ErrUnknownResolution) {
+		t.Errorf("Rollups at raw resolution: got %v, want ErrUnknownResolution", err)
+	}
+}
+
+func TestResults(t *testing.T) {
+	s := openTestStore(t)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		record(t, s, "rpc", Result{Time: start.Add(time.Duration(i) * time.Second), Status: "up"})
+	}
+
+	got, truncated, err := s.Results("rpc", start.Add(time.Second), start.Add(3*time.Second))
+	if err != nil {
+		t.Fatalf("Results: %v", err)
+	}
+	if truncated || len(got) != 3 {
+		t.Fatalf("got %d results (truncated %v), want 3", len(got), truncated)
+	}
+	for i, r := range got {
+		if want := start.Add(time.Duration(i+1) * time.Second); !r.Time.Equal(want) {
+			t.Errorf("result %d at %s, want %s", i, r.Time, want)
+		}
+	}
+}
+
+func TestSummary(t *testing.T) {
+	s := openTestStore(t)
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	record(t, s, "rpc",
+		Result{Time: start, Status: "up", LatencyMs: 10},
+		Result{Time: start.Add(time.Minute), Status: "up", LatencyMs: 20},
+		Result{Time: start.Add(time.Hour), Status: "degraded", LatencyMs: 90},
+		Result{Time: start.Add(2 * time.Hour), Status: "down"},
+	)
+
+	got, err := s.Summary("rpc", start.Add(30*time.Minute))
+	if err != nil {
+		t.Fatalf("Summary: %v", err)
+	}
+	want := Rollup{Start: start, Checks: 4, Up: 2, Degraded: 1, Down: 1, Availability: 75, LatencyMinMs: 10, LatencyMaxMs: 90}
+	avg := got.LatencyAvgMs
+	got.LatencyAvgMs = 0
+	if !got.Start.Equal(want.Start) {
+		t.Errorf("summary starts at %s, want %s", got.Start, want.Start)
+	}
+	got.Start = want.Start
+	if got != want {
+		t.Errorf("summary = %+v, want %+v", got, want)
+	}
+	// Weighted by available checks: (10 + 20 + 90) / 3
+	if math.Abs(avg-40) > 1e-9 {
+		t.Errorf("average latency = %v, want 40", avg)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	retention := Retention{Raw: time.Hour, Minute: 24 * time.Hour, Hour: 7 * 24 * time.Hour}
+
+	tests := []struct {
+		name string
+		age  time.Duration
+		// entries left at each resolution
+		raw, minute, hour int
+	}{
+		{"fresh", 30 * time.Minute, 1, 1, 1},
+		{"past raw retention", 2 * time.Hour, 0, 1, 1},
+		{"past minute retention", 2 * 24 * time.Hour, 0, 0, 1},
+		{"past hour retention", 8 * 24 * time.Hour, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openTestStore(t)
+			at := now.Add(-tt.age)
+			for _, service := range []string{"rpc", "wss"} {
+				record(t, s, service, Result{Time: at, Status: "up"})
+			}
+
+			removed, err := s.Prune(now, retention)
+			if err != nil {
+				t.Fatalf("Prune: %v", err)
+			}
+			if want := 2 * (3 - tt.raw - tt.minute - tt.hour); removed != want {
+				t.Errorf("removed %d entries, want %d", removed, want)
+			}
+
+			for _, service := range []string{"rpc", "wss"} {
+				results, _, _ := s.Results(service, at, at)
+				minutes, _, _ := s.Rollups(service, Minute, at, at)
+				hours, _, _ := s.Rollups(service, Hour, at, at)
+				if len(results) != tt.raw || len(minutes) != tt.minute || len(hours) != tt.hour {
+					t.Errorf("%s kept %d raw, %d minute and %d hour entries, want %d, %d and %d",
+						service, len(results), len(minutes), len(hours), tt.raw, tt.minute, tt.hour)
+				}
+			}
+		})
+	}
+}
+
+func TestPruneRemovesEveryExpiredEntry(t *testing.T) {
+	// Deleting while iterating must not skip entries
+	s := openTestStore(t)
+	now := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 100; i++ {
+		record(t, s, "rpc", Result{Time: now.Add(-time.Duration(i) * time.Minute), Status: "up"})
+	}
+
+	if _, err := s.Prune(now, Retention{Raw: 30*time.Minute + time.Second, Minute: 24 * time.Hour, Hour: 24 * time.Hour}); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	results, _, err := s.Results("rpc", now.Add(-time.Hour*2), now)
+	if err != nil {
+		t.Fatalf("Results: %v", err)
+	}
+	if len(results) != 30 {
+		t.Errorf("kept %d raw results, want 30", len(results))
+	}
+}
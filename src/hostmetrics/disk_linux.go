@@ -0,0 +1,28 @@
+package hostmetrics
+
+import "syscall"
+
+// diskUsage returns the usage of the filesystem holding workDir and of
+// those mounted below it. Pseudo filesystems without blocks are skipped.
+func diskUsage(workDir string) []Disk {
+	var disks []Disk
+	for _, m := range mountsFor(workDir) {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(m.point, &st); err != nil || st.Blocks == 0 {
+			continue
+		}
+		size := uint64(st.Bsize)
+		used := (st.Blocks - st.Bfree) * size
+		available := st.Bavail * size
+		disks = append(disks, Disk{
+			Mount:          m.point,
+			FSType:         m.fsType,
+			TotalBytes:     st.Blocks * size,
+			AvailableBytes: available,
+			// As df: blocks reserved for root count as neither used nor
+			// available
+			UsedPercent: percent(used, used+available),
+		})
+	}
+	return disks
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package hostmetrics
+
+// diskUsage is only implemented on Linux
+func diskUsage(workDir string) []Disk {
+	return nil
+}
@@ -0,0 +1,136 @@
+// Package hostmetrics samples host resource usage from /proc, so reports
+// show whether a degraded service runs on a starved host.
+package hostmetrics
+
+import (
+	"sync"
+	"time"
+)
+
+// procRoot is where the proc filesystem is mounted
+const procRoot = "/proc"
+
+// minRateInterval is the shortest interval over which CPU and network rates
+// are computed. Samples requested sooner repeat the previous one, so an
+// extra report cannot produce rates from a few milliseconds of activity.
+const minRateInterval = time.Second
+
+// Sample is a snapshot of host resource usage. Sections that cannot be read
+// on this host are omitted. CPU and Network are rates over the interval since
+// the previous sample and are missing from the first one.
+type Sample struct {
+	Load            *Load            `json:"load,omitempty"`
+	CPU             *CPU             `json:"cpu,omitempty"`
+	Memory          *Memory          `json:"memory,omitempty"`
+	Disks           []Disk           `json:"disks,omitempty"`
+	Network         []Interface      `json:"network,omitempty"`
+	FileDescriptors *FileDescriptors `json:"file_descriptors,omitempty"`
+	UptimeSeconds   float64          `json:"uptime_seconds,omitempty"`
+}
+
+// Load holds the load averages
+type Load struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+// CPU holds the share of CPU time spent busy, waiting for I/O and stolen by
+// the hypervisor, across all cores
+type CPU struct {
+	Cores              int     `json:"cores"`
+	UtilizationPercent float64 `json:"utilization_percent"`
+	IOWaitPercent      float64 `json:"iowait_percent"`
+	StealPercent       float64 `json:"steal_percent"`
+}
+
+// Memory holds memory and swap usage
+type Memory struct {
+	TotalBytes     uint64  `json:"total_bytes"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+	SwapTotalBytes uint64  `json:"swap_total_bytes"`
+	SwapUsedBytes  uint64  `json:"swap_used_bytes"`
+}
+
+// Disk holds usage of a filesystem mounted at or under the work directory
+type Disk struct {
+	Mount          string  `json:"mount"`
+	FSType         string  `json:"fs_type"`
+	TotalBytes     uint64  `json:"total_bytes"`
+	AvailableBytes uint64  `json:"available_bytes"`
+	UsedPercent    float64 `json:"used_percent"`
+}
+
+// Interface holds the throughput of a network interface and its error and
+// drop counters since boot
+type Interface struct {
+	Name             string  `json:"name"`
+	RxBytesPerSecond float64 `json:"rx_bytes_per_second"`
+	TxBytesPerSecond float64 `json:"tx_bytes_per_second"`
+	RxErrors         uint64  `json:"rx_errors"`
+	TxErrors         uint64  `json:"tx_errors"`
+	RxDropped        uint64  `json:"rx_dropped"`
+	TxDropped        uint64  `json:"tx_dropped"`
+}
+
+// FileDescriptors holds open file descriptors of the host and of the agent
+type FileDescriptors struct {
+	HostAllocated uint64 `json:"host_allocated"`
+	HostMax       uint64 `json:"host_max"`
+	Process       uint64 `json:"process"`
+	ProcessLimit  uint64 `json:"process_limit,omitempty"`
+}
+
+// Collector samples host metrics, keeping the counters of the previous
+// sample to compute rates
+type Collector struct {
+	mu      sync.Mutex
+	last    Sample
+	lastAt  time.Time
+	prevCPU cpuTimes
+	prevNet map[string]netCounters
+}
+
+// NewCollector creates a collector
+func NewCollector() *Collector {
+	return &Collector{}
+}
+
+// Collect samples host metrics. workDir selects the filesystems reported in
+// Disks: the one holding it and any mounted below it.
+func (c *Collector) Collect(workDir string) Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(c.lastAt)
+	if !c.lastAt.IsZero() && elapsed < minRateInterval {
+		return c.last
+	}
+
+	sample := Sample{
+		Load:            readLoad(),
+		Memory:          readMemory(),
+		Disks:           diskUsage(workDir),
+		FileDescriptors: readFileDescriptors(),
+		UptimeSeconds:   readUptime(),
+	}
+
+	if cpu, ok := readCPU(); ok {
+		if !c.lastAt.IsZero() {
+			sample.CPU = cpu.usageSince(c.prevCPU)
+		}
+		c.prevCPU = cpu
+	}
+	if counters, ok := readNetwork(); ok {
+		if !c.lastAt.IsZero() {
+			sample.Network = interfaceRates(c.prevNet, counters, elapsed)
+		}
+		c.prevNet = counters
+	}
+
+	c.last = sample
+	c.lastAt = now
+	return sample
+}
@@ -0,0 +1,292 @@
+package hostmetrics
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cpuTimes holds the aggregate jiffies from the cpu line of /proc/stat
+type cpuTimes struct {
+	cores  int
+	total  uint64
+	idle   uint64
+	iowait uint64
+	steal  uint64
+}
+
+// netCounters holds the counters of one interface from /proc/net/dev
+type netCounters struct {
+	rxBytes, txBytes     uint64
+	rxErrors, txErrors   uint64
+	rxDropped, txDropped uint64
+}
+
+func readLoad() *Load {
+	fields, ok := readFields("loadavg")
+	if !ok || len(fields) < 3 {
+		return nil
+	}
+	return &Load{
+		Load1:  parseFloat(fields[0]),
+		Load5:  parseFloat(fields[1]),
+		Load15: parseFloat(fields[2]),
+	}
+}
+
+func readUptime() float64 {
+	fields, ok := readFields("uptime")
+	if !ok || len(fields) < 1 {
+		return 0
+	}
+	return parseFloat(fields[0])
+}
+
+func readMemory() *Memory {
+	values := make(map[string]uint64)
+	if !scanLines("meminfo", func(line string) {
+		key, rest, found := strings.Cut(line, ":")
+		if fields := strings.Fields(rest); found && len(fields) > 0 {
+			values[key] = parseUint(fields[0]) * 1024 // kB
+		}
+	}) {
+		return nil
+	}
+
+	total, available := values["MemTotal"], values["MemAvailable"]
+	if total == 0 {
+		return nil
+	}
+	return &Memory{
+		TotalBytes:     total,
+		AvailableBytes: available,
+		UsedPercent:    percent(total-available, total),
+		SwapTotalBytes: values["SwapTotal"],
+		SwapUsedBytes:  values["SwapTotal"] - values["SwapFree"],
+	}
+}
+
+func readCPU() (cpuTimes, bool) {
+	var times cpuTimes
+	found := false
+	scanLines("stat", func(line string) {
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+		case fields[0] == "cpu" && len(fields) >= 9:
+			// user nice system idle iowait irq softirq steal; guest time
+			// is already included in user
+			for _, f := range fields[1:9] {
+				times.total += parseUint(f)
+			}
+			times.idle = parseUint(fields[4])
+			times.iowait = parseUint(fields[5])
+			times.steal = parseUint(fields[8])
+			found = true
+		case strings.HasPrefix(fields[0], "cpu"):
+			times.cores++
+		}
+	})
+	return times, found
+}
+
+// usageSince returns CPU usage over the interval since prev
+func (t cpuTimes) usageSince(prev cpuTimes) *CPU {
+	if t.total <= prev.total {
+		return nil
+	}
+	total := t.total - prev.total
+	idle := delta(t.idle, prev.idle) + delta(t.iowait, prev.iowait)
+	return &CPU{
+		Cores:              t.cores,
+		UtilizationPercent: percent(total-min(idle, total), total),
+		IOWaitPercent:      percent(delta(t.iowait, prev.iowait), total),
+		StealPercent:       percent(delta(t.steal, prev.steal), total),
+	}
+}
+
+func readNetwork() (map[string]netCounters, bool) {
+	counters := make(map[string]netCounters)
+	ok := scanLines("net/dev", func(line string) {
+		name, rest, found := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(rest)
+		if !found || name == "lo" || len(fields) < 12 {
+			return
+		}
+		counters[name] = netCounters{
+			rxBytes:   parseUint(fields[0]),
+			rxErrors:  parseUint(fields[2]),
+			rxDropped: parseUint(fields[3]),
+			txBytes:   parseUint(fields[8]),
+			txErrors:  parseUint(fields[10]),
+			txDropped: parseUint(fields[11]),
+		}
+	})
+	return counters, ok
+}
+
+// interfaceRates returns the throughput of every interface present in both
+// samples, sorted by name
+func interfaceRates(prev, cur map[string]netCounters, elapsed time.Duration) []Interface {
+	seconds := elapsed.Seconds()
+	interfaces := make([]Interface, 0, len(cur))
+	for name, c := range cur {
+		p, ok := prev[name]
+		if !ok {
+			continue
+		}
+		interfaces = append(interfaces, Interface{
+			Name:             name,
+			RxBytesPerSecond: float64(delta(c.rxBytes, p.rxBytes)) / seconds,
+			TxBytesPerSecond: float64(delta(c.txBytes, p.txBytes)) / seconds,
+			RxErrors:         c.rxErrors,
+			TxErrors:         c.txErrors,
+			RxDropped:        c.rxDropped,
+			TxDropped:        c.txDropped,
+		})
+	}
+	sort.Slice(interfaces, func(i, j int) bool { return interfaces[i].Name < interfaces[j].Name })
+	return interfaces
+}
+
+func readFileDescriptors() *FileDescriptors {
+	// allocated, unused (always 0 since Linux 2.6), max
+	fields, ok := readFields("sys/fs/file-nr")
+	if !ok || len(fields) < 3 {
+		return nil
+	}
+	fds := &FileDescriptors{
+		HostAllocated: parseUint(fields[0]),
+		HostMax:       parseUint(fields[2]),
+	}
+
+	if entries, err := os.ReadDir(filepath.Join(procRoot, "self", "fd")); err == nil {
+		fds.Process = uint64(len(entries))
+	}
+	scanLines("self/limits", func(line string) {
+		if rest, found := strings.CutPrefix(line, "Max open files"); found {
+			if fields := strings.Fields(rest); len(fields) > 0 {
+				fds.ProcessLimit = parseUint(fields[0])
+			}
+		}
+	})
+	return fds
+}
+
+// mount is an entry of /proc/self/mounts
+type mount struct {
+	point  string
+	fsType string
+}
+
+// mountsFor returns the mount holding dir followed by the mounts below it
+func mountsFor(dir string) []mount {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	dir = filepath.Clean(dir)
+
+	var holder mount
+	var below []mount
+	scanLines("self/mounts", func(line string) {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return
+		}
+		m := mount{point: unescapeMount(fields[1]), fsType: fields[2]}
+		switch {
+		case within(dir, m.point):
+			if len(m.point) >= len(holder.point) {
+				holder = m
+			}
+		case within(m.point, dir):
+			below = append(below, m)
+		}
+	})
+
+	if holder.point == "" {
+		return below
+	}
+	return append([]mount{holder}, below...)
+}
+
+// within reports whether path is root or below it
+func within(path, root string) bool {
+	return path == root || root == "/" || strings.HasPrefix(path, root+"/")
+}
+
+// unescapeMount decodes the octal escapes (\040 for a space) used in
+// /proc/self/mounts
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// readFields returns the whitespace separated fields of a file under /proc
+func readFields(name string) ([]string, bool) {
+	data, err := os.ReadFile(filepath.Join(procRoot, name))
+	if err != nil {
+		return nil, false
+	}
+	return strings.Fields(string(data)), true
+}
+
+// scanLines calls fn for every line of a file under /proc
+func scanLines(name string, fn func(string)) bool {
+	f, err := os.Open(filepath.Join(procRoot, name))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+	return scanner.Err() == nil
+}
+
+func parseUint(s string) uint64 {
+	n, _ := strconv.ParseUint(s, 10, 64)
+	return n
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+// delta returns cur - prev, or 0 if the counter was reset
+func delta(cur, prev uint64) uint64 {
+	if cur < prev {
+		return 0
+	}
+	return cur - prev
+}
+
+// percent returns part/total as a percentage rounded to two decimals
+func percent(part, total uint64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)/float64(total)*10000) / 100
+}
@@ -0,0 +1,140 @@
+// Package incidents follows the reported state of each service and keeps an
+// incident open for as long as a service is down.
+package incidents
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// StatusDown is the reported status that opens an incident
+const StatusDown = "down"
+
+// StatusRemoved is the To status of the change resolving the incident of a
+// service removed from the configuration
+const StatusRemoved = "removed"
+
+// Incident is a period during which a service was reported down
+type Incident struct {
+	ID         string     `json:"id"`
+	Service    string     `json:"service"`
+	StartedAt  time.Time  `json:"started_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	Error      string     `json:"error,omitempty"` // error that opened the incident
+}
+
+// Change is a transition of a service from one reported status to another.
+// From is empty when the first status seen for a service is down.
+type Change struct {
+	Service  string    `json:"service"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Error    string    `json:"error,omitempty"`
+	At       time.Time `json:"at"`
+	Incident *Incident `json:"incident,omitempty"` // incident opened or resolved by the change
+}
+
+// Tracker is a thread-safe record of the last status of each service
+type Tracker struct {
+	mu       sync.Mutex
+	services map[string]*serviceState
+}
+
+type serviceState struct {
+	status   string
+	incident *Incident
+}
+
+// NewTracker creates an empty tracker
+func NewTracker() *Tracker {
+	return &Tracker{services: make(map[string]*serviceState)}
+}
+
+// Observe records the status of a service at the given time and returns
+// the change, if any. An incident is opened when a service goes down and
+// resolved when it comes back. The first status seen for a service is only
+// a change if it is down.
+func (t *Tracker) Observe(service, status, errMsg string, at time.Time) (Change, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.services[service]
+	if !ok {
+		state = &serviceState{}
+		t.services[service] = state
+	}
+	if state.status == status || (!ok && status != StatusDown) {
+		state.status = status
+		return Change{}, false
+	}
+
+	change := Change{Service: service, From: state.status, To: status, Error: errMsg, At: at}
+	switch {
+	case status == StatusDown:
+		state.incident = &Incident{ID: newID(), Service: service, StartedAt: at, Error: errMsg}
+		opened := *state.incident
+		change.Incident = &opened
+	case state.incident != nil:
+		resolvedAt := at
+		resolved := *state.incident
+		resolved.ResolvedAt = &resolvedAt
+		change.Incident = &resolved
+		state.incident = nil
+	}
+	state.status = status
+	return change, true
+}
+
+// Open returns the open incident of a service, if it has one
+func (t *Tracker) Open(service string) (Incident, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state, ok := t.services[service]
+	if !ok || state.incident == nil {
+		return Incident{}, false
+	}
+	return *state.incident, true
+}
+
+// Retain forgets services not in names. The incidents still open for them
+// are resolved at the given time and returned as changes to StatusRemoved.
+func (t *Tracker) Retain(names []string, at time.Time) []Change {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var changes []Change
+	for name, state := range t.services {
+		if keep[name] {
+			continue
+		}
+		if state.incident != nil {
+			resolvedAt := at
+			resolved := *state.incident
+			resolved.ResolvedAt = &resolvedAt
+			changes = append(changes, Change{
+				Service:  name,
+				From:     state.status,
+				To:       StatusRemoved,
+				Error:    "service removed from configuration",
+				At:       at,
+				Incident: &resolved,
+			})
+		}
+		delete(t.services, name)
+	}
+	return changes
+}
+
+// newID returns a random incident ID
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,135 @@
+package incidents
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObserve(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	type step struct {
+		status  string
+		changed bool
+		from    string
+		opened  bool // the change opens an incident
+		closed  bool // the change resolves an incident
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"first status up is not a change", []step{
+			{status: "up"},
+		}},
+		{"first status down opens an incident", []step{
+			{status: "down", changed: true, opened: true},
+		}},
+		{"unchanged status", []step{
+			{status: "up"},
+			{status: "up"},
+		}},
+		{"down and back", []step{
+			{status: "up"},
+			{status: "down", changed: true, from: "up", opened: true},
+			{status: "down"},
+			{status: "up", changed: true, from: "down", closed: true},
+		}},
+		{"degraded neither opens nor resolves", []step{
+			{status: "up"},
+			{status: "degraded", changed: true, from: "up"},
+			{status: "up", changed: true, from: "degraded"},
+		}},
+		{"degraded resolves a down incident", []step{
+			{status: "down", changed: true, opened: true},
+			{status: "degraded", changed: true, from: "down", closed: true},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewTracker()
+			var open *Incident
+			for i, s := range tt.steps {
+				at := start.Add(time.Duration(i) * time.Minute)
+				change, changed := tracker.Observe("rpc", s.status, "", at)
+				if changed != s.changed {
+					t.Fatalf("step %d: changed = %v, want %v", i, changed, s.changed)
+				}
+				if !changed {
+					continue
+				}
+				if change.From != s.from || change.To != s.status || !change.At.Equal(at) {
+					t.Errorf("step %d: change %s -> %s at %s, want %s -> %s at %s", i, change.From, change.To, change.At, s.from, s.status, at)
+				}
+
+				switch {
+				case s.opened:
+					if change.Incident == nil || change.Incident.ResolvedAt != nil || !change.Incident.StartedAt.Equal(at) {
+						t.Fatalf("step %d: incident %+v, want one opened at %s", i, change.Incident, at)
+					}
+					open = change.Incident
+				case s.closed:
+					inc := change.Incident
+					if inc == nil || inc.ID != open.ID || inc.ResolvedAt == nil || !inc.ResolvedAt.Equal(at) {
+						t.Fatalf("step %d: incident %+v, want %s resolved at %s", i, inc, open.ID, at)
+					}
+					open = nil
+				default:
+					if change.Incident != nil {
+						t.Errorf("step %d: unexpected incident %+v", i, change.Incident)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestObserveNewIncidentEachTime(t *testing.T) {
+	tracker := NewTracker()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	first, _ := tracker.Observe("rpc", StatusDown, "timeout", now)
+	tracker.Observe("rpc", "up", "", now.Add(time.Minute))
+	second, _ := tracker.Observe("rpc", StatusDown, "refused", now.Add(2*time.Minute))
+
+	if first.Incident.ID == second.Incident.ID {
+		t.Errorf("both incidents have ID %s", first.Incident.ID)
+	}
+	if first.Incident.Error != "timeout" || second.Incident.Error != "refused" {
+		t.Errorf("incident errors %q and %q, want the error that opened each", first.Incident.Error, second.Incident.Error)
+	}
+}
+
+func TestRetain(t *testing.T) {
+	tracker := NewTracker()
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	opened, _ := tracker.Observe("down", StatusDown, "timeout", now)
+	tracker.Observe("up", "up", "", now)
+	tracker.Observe("kept", StatusDown, "", now)
+
+	removedAt := now.Add(time.Hour)
+	changes := tracker.Retain([]string{"kept"}, removedAt)
+	if len(changes) != 1 {
+		t.Fatalf("got %d changes, want 1 for the open incident: %+v", len(changes), changes)
+	}
+	change := changes[0]
+	if change.Service != "down" || change.From != StatusDown || change.To != StatusRemoved || !change.At.Equal(removedAt) {
+		t.Errorf("change %+v, want down -> removed at %s", change, removedAt)
+	}
+	if inc := change.Incident; inc == nil || inc.ID != opened.Incident.ID || inc.ResolvedAt == nil || !inc.ResolvedAt.Equal(removedAt) {
+		t.Errorf("incident %+v, want %s resolved at %s", change.Incident, opened.Incident.ID, removedAt)
+	}
+
+	// The kept service keeps its incident; removed services start over
+	if _, changed := tracker.Observe("kept", StatusDown, "", removedAt); changed {
+		t.Error("kept service lost its state")
+	}
+	if _, changed := tracker.Observe("up", "up", "", removedAt); changed {
+		t.Error("re-added service reported a change for its first status")
+	}
+	if changes := tracker.Retain([]string{"kept", "up"}, removedAt); len(changes) != 0 {
+		t.Errorf("second Retain returned %+v", changes)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync/atomic"
 )
 
 type LogLevel int
@@ -18,10 +19,14 @@ const (
 )
 
 var (
-	currentLevel LogLevel = LevelInfo
+	currentLevel atomic.Int32
 	logger       *log.Logger
 )
 
+func init() {
+	currentLevel.Store(int32(LevelInfo))
+}
+
 func ensureLogger() {
 	if logger == nil {
 		logger = log.New(os.Stdout, "", log.LstdFlags|log.Lmicroseconds)
@@ -75,27 +80,57 @@ func formatMessage(msg string, args ...interface{}) string {
 	return builder.String()
 }
 
-// SetLevel sets the log level
-func SetLevel(level string) {
+// ParseLevel parses a level name (case-insensitive)
+func ParseLevel(level string) (LogLevel, bool) {
 	switch strings.ToLower(level) {
 	case "debug":
-		currentLevel = LevelDebug
+		return LevelDebug, true
 	case "info":
-		currentLevel = LevelInfo
+		return LevelInfo, true
 	case "warn", "warning":
-		currentLevel = LevelWarn
+		return LevelWarn, true
 	case "error":
-		currentLevel = LevelError
+		return LevelError, true
 	case "fatal":
-		currentLevel = LevelFatal
+		return LevelFatal, true
+	default:
+		return LevelInfo, false
+	}
+}
+
+// SetLevel sets the log level; unknown names fall back to Info. It is safe
+// to call while other goroutines are logging.
+func SetLevel(level string) {
+	parsed, _ := ParseLevel(level)
+	currentLevel.Store(int32(parsed))
+}
+
+// GetLevel returns the current log level
+func GetLevel() LogLevel {
+	return LogLevel(currentLevel.Load())
+}
+
+// String returns the level name
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "Debug"
+	case LevelInfo:
+		return "Info"
+	case LevelWarn:
+		return "Warn"
+	case LevelError:
+		return "Error"
+	case LevelFatal:
+		return "Fatal"
 	default:
-		currentLevel = LevelInfo
+		return fmt.Sprintf("LogLevel(%d)", int(l))
 	}
 }
 
 // shouldLog returns true if the given level should be logged
 func shouldLog(level LogLevel) bool {
-	return level >= currentLevel
+	return level >= GetLevel()
 }
 
 // Debug logs a debug message
@@ -7,12 +7,13 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
-	"time"
 
 	"github.com/ibp-network/ibp-geodns-agent/src/agent"
 	"github.com/ibp-network/ibp-geodns-agent/src/config"
 	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/schema"
 )
 
 var (
@@ -37,6 +38,8 @@ func main() {
 		configPath  = flag.String("config", "/etc/ibpdns/agent.json", "Path to configuration file")
 		showVersion = flag.Bool("version", false, "Show version information")
 		logLevel    = flag.String("log-level", "", "Override log level (Debug, Info, Warn, Error)")
+		checkConfig = flag.Bool("check-config", false, "Validate the configuration file and exit (non-zero on errors)")
+		printSchema = flag.String("schema", "", "Print the JSON Schema for config or report and exit")
 	)
 	flag.Parse()
 
@@ -45,6 +48,20 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *printSchema != "" {
+		data, ok := schema.Lookup(*printSchema)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown schema %q (available: %s)\n", *printSchema, strings.Join(schema.Names(), ", "))
+			os.Exit(2)
+		}
+		os.Stdout.Write(data)
+		os.Exit(0)
+	}
+
+	if *checkConfig {
+		os.Exit(runConfigCheck(*configPath))
+	}
+
 	// Initialize logging
 	logging.Init(*logLevel)
 
@@ -54,13 +71,13 @@ func main() {
 		logging.Fatal("Failed to load configuration", "error", err)
 	}
 
-	// Override log level if specified via flag
+	// The flag overrides the configured log level until the configured level
+	// changes; the configuration itself is left as loaded
+	level := cfg.System.LogLevel
 	if *logLevel != "" {
-		cfg.System.LogLevel = *logLevel
+		level = *logLevel
 	}
-
-	// Set log level from config
-	logging.SetLevel(cfg.System.LogLevel)
+	logging.SetLevel(level)
 
 	logging.Info("Starting ibp-geodns-agent", "version", version, "config", *configPath)
 
@@ -73,6 +90,7 @@ func main() {
 	if err != nil {
 		logging.Fatal("Failed to initialize agent", "error", err)
 	}
+	a.SetVersionInfo(GetVersion())
 
 	// Start agent
 	if err := a.Start(ctx); err != nil {
@@ -88,9 +106,16 @@ func main() {
 	logging.Info("Received shutdown signal", "signal", sig.String())
 
 	// Create shutdown context with timeout
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), a.ShutdownTimeout())
 	defer shutdownCancel()
 
+	// A second signal aborts the graceful shutdown
+	go func() {
+		sig := <-sigChan
+		logging.Warn("Received second shutdown signal; exiting immediately", "signal", sig.String())
+		os.Exit(1)
+	}()
+
 	// Stop agent gracefully
 	if err := a.Stop(shutdownCtx); err != nil {
 		logging.Error("Error during agent shutdown", "error", err)
@@ -98,3 +123,27 @@ func main() {
 		logging.Info("Agent stopped gracefully")
 	}
 }
+
+// runConfigCheck validates the configuration file, prints every problem found
+// and returns the process exit code
+func runConfigCheck(configPath string) int {
+	result, err := config.Check(configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", configPath, err)
+		return 1
+	}
+
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", warning)
+	}
+	for _, issue := range result.Errors {
+		fmt.Fprintf(os.Stderr, "error: %s\n", issue)
+	}
+
+	if len(result.Errors) > 0 {
+		fmt.Fprintf(os.Stderr, "%s: %d error(s), %d warning(s)\n", configPath, len(result.Errors), len(result.Warnings))
+		return 1
+	}
+	fmt.Printf("%s: configuration OK (%d warning(s))\n", configPath, len(result.Warnings))
+	return 0
+}
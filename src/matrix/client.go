@@ -0,0 +1,367 @@
+// Package matrix posts notifications to a Matrix room through the
+// client-server API.
+//
+// The client logs in once with a password and keeps the session, including
+// its refresh token, in a file so restarts reuse the same device instead of
+// logging in again. Access tokens are refreshed shortly before they expire
+// and whenever the homeserver rejects one; a new login is only attempted
+// when the session cannot be refreshed.
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+)
+
+// deviceName is shown in the account's device list
+const deviceName = "ibp-geodns-agent"
+
+// refreshBefore is how long before expiry an access token is refreshed
+const refreshBefore = time.Minute
+
+// maxResponseBytes bounds homeserver responses
+const maxResponseBytes = 1 << 20
+
+// Error is an error response from the homeserver
+type Error struct {
+	Status       int    `json:"-"`
+	Code         string `json:"errcode"`
+	Message      string `json:"error"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("matrix: %s (HTTP %d): %s", e.Code, e.Status, e.Message)
+}
+
+// RetryAfter returns how long the homeserver asked to wait before retrying,
+// or zero if it did not rate limit the request
+func (e *Error) RetryAfter() time.Duration {
+	if e.Status != http.StatusTooManyRequests {
+		return 0
+	}
+	return time.Duration(e.RetryAfterMs) * time.Millisecond
+}
+
+// session is a logged-in device, persisted between restarts
+type session struct {
+	HomeServer   string    `json:"home_server"`
+	Username     string    `json:"username"`
+	UserID       string    `json:"user_id"`
+	DeviceID     string    `json:"device_id"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"` // zero if the token does not expire
+}
+
+// Client is a minimal Matrix client authenticated with a password
+type Client struct {
+	homeServer  string
+	username    string
+	password    string
+	sessionFile string
+	http        *http.Client
+
+	mu      sync.Mutex
+	session *session
+	logins  uint64
+}
+
+// NewClient creates a client for homeServer that logs in as username and
+// keeps its session in sessionFile. An empty sessionFile keeps the session
+// in memory only.
+func NewClient(homeServer, username, password, sessionFile string) *Client {
+	return &Client{
+		homeServer:  strings.TrimRight(homeServer, "/"),
+		username:    username,
+		password:    password,
+		sessionFile: sessionFile,
+		http:        &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// UserID returns the Matrix ID of the logged-in user, or "" before login
+func (c *Client) UserID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.session == nil {
+		return ""
+	}
+	return c.session.UserID
+}
+
+// Logins returns how many password logins the client has made
+func (c *Client) Logins() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.logins
+}
+
+// JoinRoom joins a room by ID or alias and returns its room ID. Joining a
+// room the user is already in succeeds.
+func (c *Client) JoinRoom(ctx context.Context, room string) (string, error) {
+	var resp struct {
+		RoomID string `json:"room_id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/_matrix/client/v3/join/"+url.PathEscape(room), struct{}{}, &resp); err != nil {
+		return "", err
+	}
+	return resp.RoomID, nil
+}
+
+// SendMessage sends an m.room.message event and returns its event ID.
+// Repeating a txnID makes the homeserver return the original event instead
+// of posting the message twice.
+func (c *Client) SendMessage(ctx context.Context, roomID, txnID string, content interface{}) (string, error) {
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/send/m.room.message/" + url.PathEscape(txnID)
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	if err := c.call(ctx, http.MethodPut, path, content, &resp); err != nil {
+		return "", err
+	}
+	return resp.EventID, nil
+}
+
+// call makes an authenticated request, renewing the access token once if
+// the homeserver rejects it
+func (c *Client) call(ctx context.Context, method, path string, body, out interface{}) error {
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.do(ctx, method, path, token, body, out)
+
+	var merr *Error
+	if !errors.As(err, &merr) || merr.Code != "M_UNKNOWN_TOKEN" {
+		return err
+	}
+	if token, err = c.renew(ctx, token); err != nil {
+		return err
+	}
+	return c.do(ctx, method, path, token, body, out)
+}
+
+// accessToken returns a valid access token, restoring, refreshing or
+// creating the session as needed
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session == nil {
+		c.session = c.loadSession()
+	}
+	if c.session == nil {
+		if err := c.login(ctx); err != nil {
+			return "", err
+		}
+	} else if !c.session.ExpiresAt.IsZero() && time.Until(c.session.ExpiresAt) < refreshBefore {
+		if err := c.refreshOrLogin(ctx); err != nil {
+			return "", err
+		}
+	}
+	return c.session.AccessToken, nil
+}
+
+// renew replaces a rejected access token unless another request already did
+func (c *Client) renew(ctx context.Context, rejected string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.session != nil && c.session.AccessToken != rejected {
+		return c.session.AccessToken, nil
+	}
+	if err := c.refreshOrLogin(ctx); err != nil {
+		return "", err
+	}
+	return c.session.AccessToken, nil
+}
+
+// refreshOrLogin refreshes the session, logging in again if it cannot be
+// refreshed. c.mu must be held.
+func (c *Client) refreshOrLogin(ctx context.Context) error {
+	if c.session != nil && c.session.RefreshToken != "" {
+		err := c.refresh(ctx)
+		if err == nil {
+			return nil
+		}
+		var merr *Error
+		if !errors.As(err, &merr) {
+			// The homeserver may be unreachable; the refresh token is still good
+			return err
+		}
+	}
+	return c.login(ctx)
+}
+
+// login creates a session with the password, reusing the previous device
+// if there was one. c.mu must be held.
+func (c *Client) login(ctx context.Context) error {
+	req := map[string]interface{}{
+		"type":                        "m.login.password",
+		"identifier":                  map[string]string{"type": "m.id.user", "user": c.username},
+		"password":                    c.password,
+		"initial_device_display_name": deviceName,
+		"refresh_token":               true,
+	}
+	if c.session != nil && c.session.DeviceID != "" {
+		req["device_id"] = c.session.DeviceID
+	}
+
+	var resp struct {
+		UserID       string `json:"user_id"`
+		DeviceID     string `json:"device_id"`
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresInMs  int64  `json:"expires_in_ms"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/_matrix/client/v3/login", "", req, &resp); err != nil {
+		return fmt.Errorf("matrix login failed: %w", err)
+	}
+	c.logins++
+	c.session = &session{
+		HomeServer:   c.homeServer,
+		Username:     c.username,
+		UserID:       resp.UserID,
+		DeviceID:     resp.DeviceID,
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		ExpiresAt:    expiresAt(resp.ExpiresInMs),
+	}
+	c.saveSession()
+	return nil
+}
+
+// refresh exchanges the refresh token for a new access token. c.mu must be
+// held.
+func (c *Client) refresh(ctx context.Context) error {
+	var resp struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresInMs  int64  `json:"expires_in_ms"`
+	}
+	req := map[string]string{"refresh_token": c.session.RefreshToken}
+	if err := c.do(ctx, http.MethodPost, "/_matrix/client/v3/refresh", "", req, &resp); err != nil {
+		return fmt.Errorf("matrix token refresh failed: %w", err)
+	}
+	c.session.AccessToken = resp.AccessToken
+	if resp.RefreshToken != "" {
+		c.session.RefreshToken = resp.RefreshToken
+	}
+	c.session.ExpiresAt = expiresAt(resp.ExpiresInMs)
+	c.saveSession()
+	return nil
+}
+
+// expiresAt converts a token lifetime to an expiry time
+func expiresAt(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(ms) * time.Millisecond)
+}
+
+// loadSession returns the saved session if it belongs to this homeserver
+// and user
+func (c *Client) loadSession() *session {
+	if c.sessionFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(c.sessionFile)
+	if err != nil {
+		return nil
+	}
+	var s session
+	if err := json.Unmarshal(data, &s); err != nil || s.AccessToken == "" {
+		return nil
+	}
+	if s.HomeServer != c.homeServer || s.Username != c.username {
+		return nil
+	}
+	return &s
+}
+
+// saveSession writes the session to the session file, readable only by the
+// agent. A session that cannot be saved still works until the agent stops.
+func (c *Client) saveSession() {
+	if c.sessionFile == "" {
+		return
+	}
+	if err := writeFile(c.sessionFile, c.session); err != nil {
+		logging.Warn("Failed to save Matrix session; the next start logs in again", "path", c.sessionFile, "error", err)
+	}
+}
+
+// writeFile atomically replaces path with v encoded as JSON
+func writeFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".matrix-session-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// do sends one request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path, token string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.homeServer+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", deviceName)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return fmt.Errorf("failed to read matrix response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		merr := &Error{Status: resp.StatusCode}
+		if json.Unmarshal(respBody, merr) != nil || merr.Code == "" {
+			merr.Code = "M_UNKNOWN"
+			merr.Message = strings.TrimSpace(string(respBody))
+		}
+		return merr
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("invalid matrix response: %w", err)
+	}
+	return nil
+}
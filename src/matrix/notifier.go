@@ -0,0 +1,320 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+)
+
+const (
+	// queueSize bounds notifications waiting for the rate limit
+	queueSize = 100
+
+	// sendAttempts is how often a notification is tried before it is dropped
+	sendAttempts = 3
+
+	// sendTimeout bounds one attempt, including a login if one is needed
+	sendTimeout = 30 * time.Second
+)
+
+// Notification is a message for the room
+type Notification struct {
+	Key       string // notifications with a Key posted within the dedup window are dropped
+	Thread    string // notifications with the same Thread are replies in the thread started by the first one
+	EndThread bool   // forget the thread after posting
+	Text      string // plain-text body
+	HTML      string // formatted body
+}
+
+// Options configures a Notifier
+type Options struct {
+	Room        string        // room ID or alias
+	RateLimit   int           // messages per minute, with bursts of as many
+	DedupWindow time.Duration // how long a Notification.Key suppresses repeats
+}
+
+// Stats describes the state of a Notifier
+type Stats struct {
+	UserID       string     `json:"user_id,omitempty"`
+	RoomID       string     `json:"room_id,omitempty"`
+	Queued       int        `json:"queued"`
+	Sent         uint64     `json:"sent"`
+	Deduplicated uint64     `json:"deduplicated"`
+	Dropped      uint64     `json:"dropped"` // queue full, or every attempt failed
+	Failures     uint64     `json:"failures"`
+	Logins       uint64     `json:"logins"`
+	LastError    string     `json:"last_error,omitempty"`
+	LastSent     *time.Time `json:"last_sent,omitempty"`
+}
+
+// Notifier posts notifications to a room in the background, in order, at
+// most Options.RateLimit per minute
+type Notifier struct {
+	client      *Client
+	room        string
+	rate        float64 // messages per second
+	burst       float64
+	dedupWindow time.Duration
+	queue       chan Notification
+	txnPrefix   string
+
+	mu           sync.Mutex
+	recent       map[string]time.Time
+	roomID       string
+	sent         uint64
+	deduplicated uint64
+	dropped      uint64
+	unreported   uint64 // dropped since the last message was posted
+	failures     uint64
+	lastError    string
+	lastSent     time.Time
+
+	// Used by run only
+	threads map[string]string // thread -> root event ID
+	txn     uint64
+	tokens  float64
+	refill  time.Time
+}
+
+// NewNotifier creates a notifier posting through client
+func NewNotifier(client *Client, opts Options) *Notifier {
+	rateLimit := max(opts.RateLimit, 1)
+	return &Notifier{
+		client:      client,
+		room:        opts.Room,
+		rate:        float64(rateLimit) / 60,
+		burst:       float64(rateLimit),
+		dedupWindow: opts.DedupWindow,
+		queue:       make(chan Notification, queueSize),
+		txnPrefix:   fmt.Sprintf("ibp-%d", time.Now().UnixNano()),
+		recent:      make(map[string]time.Time),
+		threads:     make(map[string]string),
+		tokens:      float64(rateLimit),
+		refill:      time.Now(),
+	}
+}
+
+// Start posts queued notifications until ctx ends
+func (n *Notifier) Start(ctx context.Context) {
+	go n.run(ctx)
+}
+
+// Notify queues a notification. It never blocks; false means it was a
+// duplicate or the queue was full.
+func (n *Notifier) Notify(note Notification) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := time.Now()
+	if note.Key != "" {
+		if at, ok := n.recent[note.Key]; ok && now.Sub(at) < n.dedupWindow {
+			n.deduplicated++
+			return false
+		}
+		for key, at := range n.recent {
+			if now.Sub(at) >= n.dedupWindow {
+				delete(n.recent, key)
+			}
+		}
+	}
+
+	// Only a queued notification suppresses its duplicates, so one dropped
+	// here can be sent again on the next try
+	select {
+	case n.queue <- note:
+		if note.Key != "" {
+			n.recent[note.Key] = now
+		}
+		return true
+	default:
+		n.dropped++
+		n.unreported++
+		return false
+	}
+}
+
+// Stats returns the current state of the notifier
+func (n *Notifier) Stats() Stats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	stats := Stats{
+		UserID:       n.client.UserID(),
+		RoomID:       n.roomID,
+		Queued:       len(n.queue),
+		Sent:         n.sent,
+		Deduplicated: n.deduplicated,
+		Dropped:      n.dropped,
+		Failures:     n.failures,
+		Logins:       n.client.Logins(),
+		LastError:    n.lastError,
+	}
+	if !n.lastSent.IsZero() {
+		lastSent := n.lastSent
+		stats.LastSent = &lastSent
+	}
+	return stats
+}
+
+func (n *Notifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case note := <-n.queue:
+			if !n.wait(ctx) {
+				return
+			}
+			n.send(ctx, note)
+		}
+	}
+}
+
+// wait takes a token from the rate limit bucket, sleeping until one is
+// available. It returns false if ctx ends first.
+func (n *Notifier) wait(ctx context.Context) bool {
+	now := time.Now()
+	n.tokens = min(n.burst, n.tokens+now.Sub(n.refill).Seconds()*n.rate)
+	n.refill = now
+	if n.tokens < 1 {
+		delay := time.Duration((1 - n.tokens) / n.rate * float64(time.Second))
+		if !sleep(ctx, delay) {
+			return false
+		}
+		n.tokens = 1
+		n.refill = time.Now()
+	}
+	n.tokens--
+	return true
+}
+
+// send posts a notification, retrying transient failures. The same
+// transaction ID is used for every attempt so a retry after a lost response
+// does not post twice.
+func (n *Notifier) send(ctx context.Context, note Notification) {
+	n.mu.Lock()
+	unreported := n.unreported
+	n.unreported = 0
+	n.mu.Unlock()
+
+	text, html := note.Text, note.HTML
+	if unreported > 0 {
+		text += fmt.Sprintf("\n(%d earlier notifications were dropped)", unreported)
+		html += fmt.Sprintf("<br><i>%d earlier notifications were dropped</i>", unreported)
+	}
+	content := map[string]interface{}{
+		"msgtype":        "m.notice",
+		"body":           text,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": html,
+	}
+	root := n.threads[note.Thread]
+	if note.Thread != "" && root != "" {
+		content["m.relates_to"] = map[string]interface{}{
+			"rel_type":        "m.thread",
+			"event_id":        root,
+			"is_falling_back": true,
+			"m.in_reply_to":   map[string]string{"event_id": root},
+		}
+	}
+
+	n.txn++
+	txnID := fmt.Sprintf("%s-%d", n.txnPrefix, n.txn)
+	for attempt := 1; ; attempt++ {
+		eventID, err := n.post(ctx, txnID, content)
+		if err == nil {
+			n.succeeded(note, root, eventID)
+			return
+		}
+
+		n.mu.Lock()
+		n.failures++
+		n.lastError = err.Error()
+		n.mu.Unlock()
+
+		delay, retry := retryDelay(err, attempt)
+		if !retry || attempt == sendAttempts || !sleep(ctx, delay) {
+			logging.Warn("Failed to post Matrix notification", "error", err, "attempts", attempt)
+			n.mu.Lock()
+			n.dropped++
+			n.unreported += unreported + 1
+			// Let the next notification with this key through, since this
+			// one never arrived
+			delete(n.recent, note.Key)
+			n.mu.Unlock()
+			return
+		}
+	}
+}
+
+// post joins the room if needed and sends the message
+func (n *Notifier) post(ctx context.Context, txnID string, content map[string]interface{}) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	n.mu.Lock()
+	roomID := n.roomID
+	n.mu.Unlock()
+	if roomID == "" {
+		joined, err := n.client.JoinRoom(ctx, n.room)
+		if err != nil {
+			return "", fmt.Errorf("failed to join %s: %w", n.room, err)
+		}
+		n.mu.Lock()
+		n.roomID = joined
+		n.mu.Unlock()
+		roomID = joined
+		logging.Info("Joined Matrix room", "room", n.room, "roomID", joined)
+	}
+	return n.client.SendMessage(ctx, roomID, txnID, content)
+}
+
+// succeeded records a posted notification and the thread it started or ended
+func (n *Notifier) succeeded(note Notification, root, eventID string) {
+	switch {
+	case note.Thread == "":
+	case note.EndThread:
+		delete(n.threads, note.Thread)
+	case root == "":
+		n.threads[note.Thread] = eventID
+	}
+
+	n.mu.Lock()
+	n.sent++
+	n.lastError = ""
+	n.lastSent = time.Now()
+	n.mu.Unlock()
+}
+
+// retryDelay returns how long to wait before another attempt, and whether
+// one is worth making
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	var merr *Error
+	if errors.As(err, &merr) {
+		if after := merr.RetryAfter(); after > 0 {
+			return after, true
+		}
+		if merr.Status >= 400 && merr.Status < 500 && merr.Status != http.StatusTooManyRequests {
+			// Forbidden, unknown room and the like will not fix themselves
+			return 0, false
+		}
+	}
+	return time.Duration(attempt) * 2 * time.Second, true
+}
+
+// sleep waits for d, returning false if ctx ends first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
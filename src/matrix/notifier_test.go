@@ -0,0 +1,260 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHomeServer accepts logins, joins and messages and records the messages
+type fakeHomeServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	joins    int
+	rejects  int // messages still to refuse with 403
+	messages []map[string]interface{}
+}
+
+func newFakeHomeServer(t *testing.T) *fakeHomeServer {
+	t.Helper()
+	f := &fakeHomeServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_matrix/client/v3/login", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"user_id": "@bot:test", "device_id": "DEV", "access_token": "token"})
+	})
+	mux.HandleFunc("/_matrix/client/v3/join/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.joins++
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"room_id": "!room:test"})
+	})
+	mux.HandleFunc("/_matrix/client/v3/rooms/", func(w http.ResponseWriter, r *http.Request) {
+		var content map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&content); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		if f.rejects > 0 {
+			f.rejects--
+			f.mu.Unlock()
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"errcode": "M_FORBIDDEN", "error": "not allowed"})
+			return
+		}
+		f.messages = append(f.messages, content)
+		id := fmt.Sprintf("$ev%d", len(f.messages))
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]string{"event_id": id})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// received returns the messages posted so far
+func (f *fakeHomeServer) received() []map[string]interface{} {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]map[string]interface{}(nil), f.messages...)
+}
+
+func newTestNotifier(homeServer string, opts Options) *Notifier {
+	return NewNotifier(NewClient(homeServer, "bot", "pw", ""), opts)
+}
+
+func TestNotifyDedup(t *testing.T) {
+	n := newTestNotifier("http://127.0.0.1:0", Options{Room: "#alerts:test", RateLimit: 10, DedupWindow: 100 * time.Millisecond})
+
+	steps := []struct {
+		key    string
+		wait   time.Duration
+		queued bool
+	}{
+		{"down:1", 0, true},
+		{"down:1", 0, false}, // repeated within the window
+		{"recovered:1", 0, true},
+		{"", 0, true}, // notifications without a key are never deduplicated
+		{"", 0, true},
+		{"down:1", 150 * time.Millisecond, true}, // the window has passed
+		{"down:1", 0, false},
+	}
+	for i, step := range steps {
+		time.Sleep(step.wait)
+		if got := n.Notify(Notification{Key: step.key, Text: "x"}); got != step.queued {
+			t.Errorf("step %d (%q): queued = %v, want %v", i, step.key, got, step.queued)
+		}
+	}
+
+	stats := n.Stats()
+	if stats.Queued != 5 || stats.Deduplicated != 2 || stats.Dropped != 0 {
+		t.Errorf("queued %d, deduplicated %d, dropped %d; want 5, 2 and 0", stats.Queued, stats.Deduplicated, stats.Dropped)
+	}
+}
+
+func TestNotifyDropsWhenQueueFull(t *testing.T) {
+	n := newTestNotifier("http://127.0.0.1:0", Options{Room: "#alerts:test", RateLimit: 10, DedupWindow: time.Hour})
+	for i := 0; i < queueSize; i++ {
+		if !n.Notify(Notification{Text: "x"}) {
+			t.Fatalf("notification %d dropped before the queue was full", i)
+		}
+	}
+	if n.Notify(Notification{Key: "down:1", Text: "x"}) {
+		t.Error("notification queued on a full queue")
+	}
+	if stats := n.Stats(); stats.Dropped != 1 || stats.Queued != queueSize {
+		t.Errorf("dropped %d with %d queued, want 1 with %d", stats.Dropped, stats.Queued, queueSize)
+	}
+}
+
+func TestNotifyAfterQueueFull(t *testing.T) {
+	n := newTestNotifier("http://127.0.0.1:0", Options{Room: "#alerts:test", RateLimit: 10, DedupWindow: time.Hour})
+	for i := 0; i < queueSize; i++ {
+		n.Notify(Notification{Text: "x"})
+	}
+	if n.Notify(Notification{Key: "down:1", Text: "x"}) {
+		t.Fatal("notification queued on a full queue")
+	}
+
+	// Once there is room the dropped notification goes through rather than
+	// being taken for a duplicate of itself
+	<-n.queue
+	if !n.Notify(Notification{Key: "down:1", Text: "x"}) {
+		t.Error("retry of a dropped notification was not queued")
+	}
+	if n.Notify(Notification{Key: "down:1", Text: "x"}) {
+		t.Error("duplicate of a queued notification was queued")
+	}
+	if stats := n.Stats(); stats.Deduplicated != 1 || stats.Dropped != 1 {
+		t.Errorf("deduplicated %d, dropped %d; want 1 and 1", stats.Deduplicated, stats.Dropped)
+	}
+}
+
+func TestNotifyAfterFailedSend(t *testing.T) {
+	server := newFakeHomeServer(t)
+	server.rejects = 1
+	n := newTestNotifier(server.URL, Options{Room: "#alerts:test", RateLimit: 600, DedupWindow: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n.Start(ctx)
+
+	waitFor := func(what string, done func(Stats) bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done(n.Stats()) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s: %+v", what, n.Stats())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// A 403 is not retried, so the notification is dropped
+	n.Notify(Notification{Key: "down:1", Text: "DOWN"})
+	waitFor("the failed send", func(s Stats) bool { return s.Dropped == 1 })
+
+	if !n.Notify(Notification{Key: "down:1", Text: "DOWN again"}) {
+		t.Fatal("notification that failed to send suppressed the next one")
+	}
+	waitFor("the second send", func(s Stats) bool { return s.Sent == 1 })
+	if messages := server.received(); len(messages) != 1 || !strings.HasPrefix(messages[0]["body"].(string), "DOWN again") {
+		t.Errorf("server received %v", messages)
+	}
+}
+
+func TestWaitRateLimit(t *testing.T) {
+	// 1200 a minute is one token every 50ms
+	n := newTestNotifier("http://127.0.0.1:0", Options{RateLimit: 1200})
+	ctx := context.Background()
+
+	// A burst of RateLimit messages is sent without waiting
+	start := time.Now()
+	for i := 0; i < 1200; i++ {
+		if !n.wait(ctx) {
+			t.Fatal("wait failed")
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("burst took %s", elapsed)
+	}
+
+	// Then one every 50ms
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		n.wait(ctx)
+	}
+	if elapsed := time.Since(start); elapsed < 120*time.Millisecond || elapsed > time.Second {
+		t.Errorf("3 messages after the burst took %s, want about 150ms", elapsed)
+	}
+
+	// A cancelled context ends the wait
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	n.tokens = 0
+	if n.wait(cancelled) {
+		t.Error("wait succeeded with a cancelled context and no tokens")
+	}
+}
+
+func TestNotifierThreads(t *testing.T) {
+	server := newFakeHomeServer(t)
+	n := newTestNotifier(server.URL, Options{Room: "#alerts:test", RateLimit: 600, DedupWindow: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	n.Start(ctx)
+
+	notes := []Notification{
+		{Key: "down:1", Thread: "1", Text: "DOWN"},
+		{Text: "unrelated"},
+		{Key: "recovered:1", Thread: "1", EndThread: true, Text: "RECOVERED"},
+		{Key: "down:1", Thread: "1", Text: "duplicate DOWN"}, // deduplicated
+		{Thread: "1", Text: "new thread"},                    // the thread was ended
+	}
+	for _, note := range notes {
+		n.Notify(note)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for n.Stats().Sent < 4 {
+		if time.Now().After(deadline) {
+			t.Fatalf("sent %d messages, want 4", n.Stats().Sent)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	messages := server.received()
+	if len(messages) != 4 {
+		t.Fatalf("server received %d messages, want 4", len(messages))
+	}
+	wantRoots := []string{"", "", "$ev1", ""} // event replied to, if any
+	for i, msg := range messages {
+		root := ""
+		if rel, ok := msg["m.relates_to"].(map[string]interface{}); ok {
+			root, _ = rel["event_id"].(string)
+		}
+		if root != wantRoots[i] {
+			t.Errorf("message %d (%s) replies to %q, want %q", i, msg["body"], root, wantRoots[i])
+		}
+		if msg["msgtype"] != "m.notice" {
+			t.Errorf("message %d has msgtype %v", i, msg["msgtype"])
+		}
+	}
+	if body, _ := messages[3]["body"].(string); !strings.HasPrefix(body, "new thread") {
+		t.Errorf("last message %q, want the new thread", body)
+	}
+
+	server.mu.Lock()
+	joins := server.joins
+	server.mu.Unlock()
+	stats := n.Stats()
+	if joins != 1 || stats.Sent != 4 || stats.Deduplicated != 1 || stats.RoomID != "!room:test" || stats.UserID != "@bot:test" {
+		t.Errorf("joins %d, stats %+v", joins, stats)
+	}
+}
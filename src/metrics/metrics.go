@@ -0,0 +1,135 @@
+// Package metrics collects agent metrics and renders them in the Prometheus
+// text exposition format for the health server's /metrics endpoint.
+//
+// Service labels are restricted to the services named in the configuration
+// (see SetServices), so label cardinality is bounded by configuration rather
+// than by whatever names reach the recording functions.
+package metrics
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Check outcomes used as the "outcome" label of ibp_agent_checks_total
+const (
+	OutcomeUp   = "up"
+	OutcomeDown = "down"
+)
+
+// Latency histogram buckets in seconds
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+var (
+	defaultRegistry = &registry{}
+
+	serviceUp = defaultRegistry.register(&family{
+		name:   "ibp_agent_service_up",
+		help:   "Whether the last check of the service succeeded (1) or failed (0).",
+		kind:   kindGauge,
+		labels: []string{"service"},
+	})
+	checkDuration = defaultRegistry.register(&family{
+		name:    "ibp_agent_check_duration_seconds",
+		help:    "Duration of service checks in seconds.",
+		kind:    kindHistogram,
+		labels:  []string{"service"},
+		buckets: latencyBuckets,
+	})
+	checksTotal = defaultRegistry.register(&family{
+		name:   "ibp_agent_checks_total",
+		help:   "Number of service checks performed by outcome.",
+		kind:   kindCounter,
+		labels: []string{"service", "outcome"},
+	})
+	reportsTotal = defaultRegistry.register(&family{
+		name:   "ibp_agent_reports_published_total",
+		help:   "Number of report publish attempts by result.",
+		kind:   kindCounter,
+		labels: []string{"result"},
+	})
+	buildInfo = defaultRegistry.register(&family{
+		name:   "ibp_agent_build_info",
+		help:   "Build information about the running agent; the value is always 1.",
+		kind:   kindGauge,
+		labels: []string{"version", "git_commit", "build_time", "go_version"},
+	})
+
+	servicesMu sync.RWMutex
+	services   = map[string]bool{}
+)
+
+func init() {
+	// Expose both results from the start so rate() works before the first failure
+	reportsTotal.add(0, "success")
+	reportsTotal.add(0, "failure")
+}
+
+// SetServices sets the service names accepted as label values. Series for
+// services no longer configured are dropped.
+func SetServices(names []string) {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+
+	servicesMu.Lock()
+	services = keep
+	servicesMu.Unlock()
+
+	serviceUp.retain(0, keep)
+	checkDuration.retain(0, keep)
+	checksTotal.retain(0, keep)
+}
+
+func knownService(name string) bool {
+	servicesMu.RLock()
+	defer servicesMu.RUnlock()
+	return services[name]
+}
+
+// ObserveCheck records the outcome and duration of a service check.
+// Checks of services not passed to SetServices are ignored.
+func ObserveCheck(service string, up bool, latency time.Duration) {
+	if !knownService(service) {
+		return
+	}
+
+	outcome, value := OutcomeDown, 0.0
+	if up {
+		outcome, value = OutcomeUp, 1.0
+	}
+	serviceUp.set(value, service)
+	checksTotal.add(1, service, outcome)
+	checkDuration.observe(latency.Seconds(), service)
+}
+
+// ObserveReportPublish records a report publish attempt
+func ObserveReportPublish(err error) {
+	if err != nil {
+		reportsTotal.add(1, "failure")
+		return
+	}
+	reportsTotal.add(1, "success")
+}
+
+// SetBuildInfo publishes the agent's build information
+func SetBuildInfo(info map[string]string) {
+	buildInfo.set(1, info["version"], info["gitCommit"], info["buildTime"], info["goVersion"])
+}
+
+// RegisterGaugeFunc registers a gauge whose value is read from fn at scrape time
+func RegisterGaugeFunc(name, help string, fn func() float64) {
+	defaultRegistry.register(&family{name: name, help: help, kind: kindGauge, fn: fn})
+}
+
+// RegisterCounterFunc registers a counter whose value is read from fn at scrape time
+func RegisterCounterFunc(name, help string, fn func() float64) {
+	defaultRegistry.register(&family{name: name, help: help, kind: kindCounter, fn: fn})
+}
+
+// Write renders all metrics in the Prometheus text exposition format
+func Write(w io.Writer) error {
+	return defaultRegistry.write(w)
+}
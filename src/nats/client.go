@@ -1,19 +1,29 @@
 package nats
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ibp-network/ibp-geodns-agent/src/config"
 	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/signing"
 	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nats.go/micro"
 )
 
+const drainPollInterval = 50 * time.Millisecond
+
 var (
 	connMu      sync.RWMutex
 	conn        *natsgo.Conn
 	callbackSem = make(chan struct{}, 128)
+	reconnects  atomic.Uint64
+	signer      atomic.Pointer[signing.Signer]
 )
 
 func currentConnection() *natsgo.Conn {
@@ -46,7 +56,8 @@ func cloneMsg(msg *natsgo.Msg) *natsgo.Msg {
 
 // Init initializes the NATS connection using the agent configuration directly.
 func Init(cfg config.NatsConfig) error {
-	if cfg.Url == "" {
+	servers := cfg.ServerURLs()
+	if len(servers) == 0 {
 		return fmt.Errorf("NATS URL is required")
 	}
 
@@ -62,39 +73,141 @@ func Init(cfg config.NatsConfig) error {
 		natsgo.MaxReconnects(-1),
 		natsgo.ReconnectWait(2 * time.Second),
 		natsgo.Timeout(10 * time.Second),
-		natsgo.DisconnectErrHandler(func(_ *natsgo.Conn, err error) {
+		natsgo.DisconnectErrHandler(func(c *natsgo.Conn, err error) {
+			recordEvent(EventDisconnected, "", err)
+			if err == nil {
+				// Deliberate close or drain
+				logging.Info("NATS disconnected")
+				return
+			}
 			logging.Error("NATS disconnected", "error", err)
 		}),
 		natsgo.ReconnectHandler(func(c *natsgo.Conn) {
-			logging.Info("NATS reconnected", "url", c.ConnectedUrl())
+			reconnects.Add(1)
+			recordEvent(EventReconnected, c.ConnectedUrlRedacted(), nil)
+			logging.Info("NATS reconnected", "url", c.ConnectedUrlRedacted(), "server", c.ConnectedServerName())
+		}),
+		natsgo.DiscoveredServersHandler(func(c *natsgo.Conn) {
+			discovered := c.DiscoveredServers()
+			recordEvent(EventDiscovered, strings.Join(discovered, ","), nil)
+			logging.Info("NATS cluster servers discovered", "servers", discovered)
 		}),
 		natsgo.ClosedHandler(func(c *natsgo.Conn) {
+			recordEvent(EventClosed, "", c.LastError())
 			if err := c.LastError(); err != nil {
 				logging.Error("NATS connection closed", "error", err)
 			}
 		}),
 	}
-	if cfg.User != "" || cfg.Pass != "" {
-		opts = append(opts, natsgo.UserInfo(cfg.User, cfg.Pass))
+	if cfg.ServerOrder == config.ServerOrderOrdered {
+		opts = append(opts, natsgo.DontRandomize())
+	}
+	if cfg.ReconnectBufferSize != 0 {
+		opts = append(opts, natsgo.ReconnectBufSize(cfg.ReconnectBufferSize))
+	}
+	if cfg.PingInterval > 0 {
+		opts = append(opts, natsgo.PingInterval(time.Duration(cfg.PingInterval)*time.Second))
+	}
+	if cfg.MaxPingsOutstanding > 0 {
+		opts = append(opts, natsgo.MaxPingsOutstanding(cfg.MaxPingsOutstanding))
+	}
+
+	authOpts, err := securityOptions(cfg)
+	if err != nil {
+		return err
 	}
+	opts = append(opts, authOpts...)
 
-	connected, err := natsgo.Connect(cfg.Url, opts...)
+	connected, err := natsgo.Connect(strings.Join(servers, ","), opts...)
 	if err != nil {
 		return fmt.Errorf("failed to connect to NATS: %w", err)
 	}
 	conn = connected
+	recordEvent(EventConnected, connected.ConnectedUrlRedacted(), nil)
+	if discovered := connected.DiscoveredServers(); len(discovered) > 0 {
+		// Servers announced in the initial handshake do not trigger the handler
+		recordEvent(EventDiscovered, strings.Join(discovered, ","), nil)
+	}
 
-	logging.Info("Connected to NATS", "nodeID", cfg.NodeID, "url", connected.ConnectedUrl())
+	logging.Info("Connected to NATS", "nodeID", cfg.NodeID, "url", connected.ConnectedUrlRedacted(), "server", connected.ConnectedServerName(), "seeds", len(servers), "order", cfg.ServerOrder, "auth", cfg.AuthMethod(), "tls", connected.TLSRequired() || cfg.TLSEnabled())
 	return nil
 }
 
-// Publish publishes a message to a subject.
+// securityOptions builds the TLS and authentication options for cfg
+func securityOptions(cfg config.NatsConfig) ([]natsgo.Option, error) {
+	var opts []natsgo.Option
+
+	// The TLS options re-read their files on every (re)connect, so rotated
+	// certificates are picked up without a restart
+	if cfg.TLSCA != "" {
+		opts = append(opts, natsgo.RootCAs(cfg.TLSCA))
+	}
+	if cfg.TLSCert != "" || cfg.TLSKey != "" {
+		opts = append(opts, natsgo.ClientCert(cfg.TLSCert, cfg.TLSKey))
+	}
+
+	switch {
+	case cfg.CredsFile != "":
+		opts = append(opts, natsgo.UserCredentials(cfg.CredsFile))
+	case cfg.NKeySeedFile != "":
+		opt, err := natsgo.NkeyOptionFromSeed(cfg.NKeySeedFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load NATS nkey seed: %w", err)
+		}
+		opts = append(opts, opt)
+	case cfg.User != "" || cfg.Pass != "":
+		opts = append(opts, natsgo.UserInfo(cfg.User, cfg.Pass))
+	}
+
+	return opts, nil
+}
+
+// Publish publishes a message to a subject, signed if a signer is set.
 func Publish(subject string, data []byte) error {
+	s := signer.Load()
+	if s == nil {
+		active := currentConnection()
+		if active == nil || active.IsClosed() {
+			return natsgo.ErrConnectionClosed
+		}
+		return active.Publish(subject, data)
+	}
+	msg := natsgo.NewMsg(subject)
+	msg.Data = data
+	return PublishMsg(msg)
+}
+
+// PublishMsg publishes a message with headers, signed if a signer is set.
+func PublishMsg(msg *natsgo.Msg) error {
 	active := currentConnection()
 	if active == nil || active.IsClosed() {
 		return natsgo.ErrConnectionClosed
 	}
-	return active.Publish(subject, data)
+
+	if s := signer.Load(); s != nil {
+		if msg.Header == nil {
+			msg.Header = natsgo.Header{}
+		}
+		if err := s.Sign(msg.Subject, msg.Data, msg.Header); err != nil {
+			return err
+		}
+	}
+	return active.PublishMsg(msg)
+}
+
+// SetSigner signs every message published from now on with s. A nil signer
+// disables signing.
+func SetSigner(s *signing.Signer) {
+	signer.Store(s)
+}
+
+// SigningKey returns the public key messages are signed with, or "" if
+// publishing is unsigned
+func SigningKey() string {
+	if s := signer.Load(); s != nil {
+		return s.PublicKey()
+	}
+	return ""
 }
 
 // Subscribe subscribes to a subject.
@@ -132,6 +245,75 @@ func GetConnection() *natsgo.Conn {
 	return currentConnection()
 }
 
+// DrainSubscriptions stops subs from receiving new messages while letting
+// messages already delivered be handled, then waits for the resulting
+// callbacks to finish or ctx to expire.
+func DrainSubscriptions(ctx context.Context, subs []*natsgo.Subscription) error {
+	for _, sub := range subs {
+		if err := sub.Drain(); err != nil && err != natsgo.ErrConnectionClosed && err != natsgo.ErrBadSubscription {
+			logging.Warn("Failed to drain subscription", "subject", sub.Subject, "error", err)
+		}
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for _, sub := range subs {
+		for sub.IsValid() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+	}
+	return waitCallbacks(ctx)
+}
+
+// Drain waits for running subscription callbacks, then drains the
+// connection so buffered publishes are flushed before it closes. If ctx
+// expires first the connection is closed immediately.
+func Drain(ctx context.Context) error {
+	active := currentConnection()
+	if active == nil || active.IsClosed() {
+		Disconnect()
+		return nil
+	}
+	defer Disconnect()
+
+	if err := waitCallbacks(ctx); err != nil {
+		logging.Warn("NATS callbacks still running at shutdown", "inFlight", len(callbackSem))
+		return err
+	}
+
+	if err := active.Drain(); err != nil {
+		return fmt.Errorf("failed to drain NATS connection: %w", err)
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for !active.IsClosed() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("NATS drain interrupted: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// waitCallbacks blocks until no subscription callback is running or ctx expires
+func waitCallbacks(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for len(callbackSem) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
 // Disconnect closes the NATS connection.
 func Disconnect() {
 	connMu.Lock()
@@ -147,3 +329,42 @@ func IsConnected() bool {
 	active := currentConnection()
 	return active != nil && active.IsConnected()
 }
+
+// Reconnects returns how many times the connection has been re-established
+// since the process started.
+func Reconnects() uint64 {
+	return reconnects.Load()
+}
+
+// CallbacksInFlight returns how many subscription callbacks are currently running.
+func CallbacksInFlight() int {
+	return len(callbackSem)
+}
+
+// CallbackCapacity returns the maximum number of concurrently running subscription callbacks.
+func CallbackCapacity() int {
+	return cap(callbackSem)
+}
+
+// AddService registers a NATS micro service on the current connection, making
+// it discoverable through $SRV.PING, $SRV.INFO and $SRV.STATS.
+func AddService(cfg micro.Config) (micro.Service, error) {
+	active := currentConnection()
+	if active == nil || active.IsClosed() {
+		return nil, natsgo.ErrConnectionClosed
+	}
+	return micro.AddService(active, cfg)
+}
+
+// KeyValue opens an existing JetStream KV bucket on the current connection.
+func KeyValue(ctx context.Context, bucket string) (jetstream.KeyValue, error) {
+	active := currentConnection()
+	if active == nil || active.IsClosed() {
+		return nil, natsgo.ErrConnectionClosed
+	}
+	js, err := jetstream.New(active)
+	if err != nil {
+		return nil, err
+	}
+	return js.KeyValue(ctx, bucket)
+}
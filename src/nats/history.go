@@ -0,0 +1,60 @@
+package nats
+
+import (
+	"sync"
+	"time"
+)
+
+const historySize = 32
+
+// Connection event types
+const (
+	EventConnected    = "connected"
+	EventDisconnected = "disconnected"
+	EventReconnected  = "reconnected"
+	EventDiscovered   = "discovered"
+	EventClosed       = "closed"
+)
+
+// ConnectionEvent is an entry in the connection history
+type ConnectionEvent struct {
+	Time   time.Time `json:"time"`
+	Event  string    `json:"event"`
+	Server string    `json:"server,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+var (
+	historyMu  sync.Mutex
+	history    []ConnectionEvent
+	lastServer string
+)
+
+// recordEvent appends an event to the history, keeping the most recent historySize entries
+func recordEvent(event, server string, err error) {
+	entry := ConnectionEvent{Time: time.Now(), Event: event, Server: server}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	switch {
+	case event == EventConnected || event == EventReconnected:
+		lastServer = server
+	case event == EventDisconnected && server == "":
+		// The connection no longer knows which server it lost
+		entry.Server = lastServer
+	}
+	history = append(history, entry)
+	if len(history) > historySize {
+		history = append([]ConnectionEvent(nil), history[len(history)-historySize:]...)
+	}
+}
+
+// History returns the most recent connection events, oldest first
+func History() []ConnectionEvent {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	return append([]ConnectionEvent(nil), history...)
+}
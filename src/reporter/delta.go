@@ -0,0 +1,67 @@
+package reporter
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// minLatencyChangeMs keeps jitter on fast services from being reported as a
+// change however large it is relative to their latency
+const minLatencyChangeMs = 5
+
+// changedServices returns the services in current that differ significantly
+// from previous, and the names of services no longer present
+func changedServices(previous, current map[string]ServiceStatus, latencyChangePercent int) (map[string]ServiceStatus, []string) {
+	changed := make(map[string]ServiceStatus)
+	for name, status := range current {
+		before, ok := previous[name]
+		if !ok || significantChange(before, status, latencyChangePercent) {
+			changed[name] = status
+		}
+	}
+
+	var removed []string
+	for name := range previous {
+		if _, ok := current[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	return changed, removed
+}
+
+// applyDelta updates published, the services as consumers last learned
+// them, with a delta report. Services left out of the delta keep the status
+// last sent, so small changes are measured against it and add up until they
+// are reported.
+func applyDelta(published, changed map[string]ServiceStatus, removed []string) {
+	for name, status := range changed {
+		published[name] = status
+	}
+	for _, name := range removed {
+		delete(published, name)
+	}
+}
+
+// significantChange reports whether a consumer holding before needs to learn
+// about after. A new check time alone is not significant.
+func significantChange(before, after ServiceStatus, latencyChangePercent int) bool {
+	if before.Status != after.Status || before.Consensus != after.Consensus || before.Error != after.Error {
+		return true
+	}
+	if !sameTime(before.CertExpiresAt, after.CertExpiresAt) {
+		return true
+	}
+
+	diff := math.Abs(after.LatencyMs - before.LatencyMs)
+	return diff >= minLatencyChangeMs && diff*100 >= before.LatencyMs*float64(latencyChangePercent)
+}
+
+// sameTime reports whether two optional times are both unset or equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
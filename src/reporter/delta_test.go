@@ -0,0 +1,158 @@
+package reporter
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSignificantChange(t *testing.T) {
+	checked := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	base := ServiceStatus{Name: "rpc", Status: "up", LatencyMs: 100, LastCheck: checked}
+	expires := checked.Add(30 * 24 * time.Hour)
+
+	tests := []struct {
+		name   string
+		mutate func(s *ServiceStatus)
+		want   bool
+	}{
+		{"unchanged", func(s *ServiceStatus) {}, false},
+		{"new check time only", func(s *ServiceStatus) { s.LastCheck = checked.Add(time.Minute) }, false},
+		{"status", func(s *ServiceStatus) { s.Status = "down" }, true},
+		{"consensus", func(s *ServiceStatus) { s.Consensus = "down" }, true},
+		{"error", func(s *ServiceStatus) { s.Error = "timeout" }, true},
+		{"latency below threshold", func(s *ServiceStatus) { s.LatencyMs = 149 }, false},
+		{"latency at threshold", func(s *ServiceStatus) { s.LatencyMs = 150 }, true},
+		{"latency drop at threshold", func(s *ServiceStatus) { s.LatencyMs = 50 }, true},
+		{"certificate seen", func(s *ServiceStatus) { s.CertExpiresAt = &expires }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			after := base
+			tt.mutate(&after)
+			if got := significantChange(base, after, 50); got != tt.want {
+				t.Errorf("significantChange = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignificantChangeFastServices(t *testing.T) {
+	// Doubling a 1ms latency is jitter, not a change worth reporting
+	before := ServiceStatus{Name: "rpc", Status: "up", LatencyMs: 1}
+	after := before
+	after.LatencyMs = 4
+	if significantChange(before, after, 50) {
+		t.Errorf("%.0fms -> %.0fms reported as a change", before.LatencyMs, after.LatencyMs)
+	}
+	after.LatencyMs = 6
+	if !significantChange(before, after, 50) {
+		t.Errorf("%.0fms -> %.0fms not reported as a change", before.LatencyMs, after.LatencyMs)
+	}
+}
+
+func TestSignificantChangeCertExpiry(t *testing.T) {
+	expires := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	renewed := expires.AddDate(0, 3, 0)
+	sameInstant := expires.In(time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		name          string
+		before, after *time.Time
+		want          bool
+	}{
+		{"both unset", nil, nil, false},
+		{"unchanged", &expires, &expires, false},
+		{"same instant in another zone", &expires, &sameInstant, false},
+		{"renewed", &expires, &renewed, true},
+		{"no longer served", &expires, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := ServiceStatus{Name: "rpc", Status: "up", CertExpiresAt: tt.before}
+			after := ServiceStatus{Name: "rpc", Status: "up", CertExpiresAt: tt.after}
+			if got := significantChange(before, after, 50); got != tt.want {
+				t.Errorf("significantChange = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChangedServices(t *testing.T) {
+	previous := map[string]ServiceStatus{
+		"same":    {Name: "same", Status: "up", LatencyMs: 10},
+		"down":    {Name: "down", Status: "up", LatencyMs: 10},
+		"removed": {Name: "removed", Status: "up"},
+		"gone":    {Name: "gone", Status: "down"},
+	}
+	current := map[string]ServiceStatus{
+		"same":  {Name: "same", Status: "up", LatencyMs: 11},
+		"down":  {Name: "down", Status: "down", Error: "timeout"},
+		"added": {Name: "added", Status: "up"},
+	}
+
+	changed, removed := changedServices(previous, current, 50)
+
+	var names []string
+	for name := range changed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if want := []string{"added", "down"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("changed = %v, want %v", names, want)
+	}
+	if want := []string{"gone", "removed"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+}
+
+func TestChangedServicesFirstReport(t *testing.T) {
+	current := map[string]ServiceStatus{"rpc": {Name: "rpc", Status: "up"}}
+	changed, removed := changedServices(nil, current, 50)
+	if len(changed) != 1 || len(removed) != 0 {
+		t.Errorf("got %d changed and %d removed, want every service changed", len(changed), len(removed))
+	}
+}
+
+func TestDeltaLatencyDrift(t *testing.T) {
+	// Latency creeping up 4% a report must still be reported once it is 10%
+	// above what consumers were last sent
+	published := map[string]ServiceStatus{"rpc": {Name: "rpc", Status: "up", LatencyMs: 100}}
+
+	var reported []float64
+	for _, latency := range []float64{104, 108, 112, 116, 120, 124} {
+		current := map[string]ServiceStatus{"rpc": {Name: "rpc", Status: "up", LatencyMs: latency}}
+		changed, removed := changedServices(published, current, 10)
+		if status, ok := changed["rpc"]; ok {
+			reported = append(reported, status.LatencyMs)
+		}
+		applyDelta(published, changed, removed)
+	}
+	if want := []float64{112, 124}; !reflect.DeepEqual(reported, want) {
+		t.Errorf("reported latencies %v, want %v", reported, want)
+	}
+	if got := published["rpc"].LatencyMs; got != 124 {
+		t.Errorf("published latency %v, want 124", got)
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	published := map[string]ServiceStatus{
+		"same":    {Name: "same", Status: "up", LatencyMs: 10},
+		"down":    {Name: "down", Status: "up"},
+		"removed": {Name: "removed", Status: "up"},
+	}
+	applyDelta(published,
+		map[string]ServiceStatus{"down": {Name: "down", Status: "down"}, "added": {Name: "added", Status: "up"}},
+		[]string{"removed"})
+
+	want := map[string]ServiceStatus{
+		"same":  {Name: "same", Status: "up", LatencyMs: 10},
+		"down":  {Name: "down", Status: "down"},
+		"added": {Name: "added", Status: "up"},
+	}
+	if !reflect.DeepEqual(published, want) {
+		t.Errorf("published = %+v, want %+v", published, want)
+	}
+}
@@ -2,49 +2,162 @@ package reporter
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ibp-network/ibp-geodns-agent/src/codec"
 	"github.com/ibp-network/ibp-geodns-agent/src/config"
 	"github.com/ibp-network/ibp-geodns-agent/src/logging"
+	"github.com/ibp-network/ibp-geodns-agent/src/metrics"
 	"github.com/ibp-network/ibp-geodns-agent/src/nats"
+	"github.com/ibp-network/ibp-geodns-agent/src/subjects"
+	natsgo "github.com/nats-io/nats.go"
 )
 
 // Reporter handles reporting agent status and metrics
 type Reporter struct {
-	config *config.Config
-	ctx    context.Context
-	cancel context.CancelFunc
+	configs  *config.Store
+	subjects subjects.Builder
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	version string
+	bootID  string
+	metrics MetricsProvider
+
+	eventSequence atomic.Uint64
+	dropped       atomic.Uint64
+
+	// sendMu serializes reports so each delta is computed against the
+	// report sent before it
+	sendMu       sync.Mutex
+	sequence     uint64
+	published    map[string]ServiceStatus // services as of the last report sent
+	lastSnapshot time.Time
+
+	mu           sync.RWMutex
+	services     map[string]ServiceStatus
+	lastReport   time.Time
+	failingSince time.Time
 }
 
 const defaultReportIntervalSeconds = 60
 
-// Report represents a status report
+// SchemaVersion is the version of the report and event payload format. It is
+// raised whenever a field is removed or its meaning changes; fields may be
+// added without a new version. Payloads without schema_version are version 1.
+const SchemaVersion = 2
+
+// Agent statuses carried by reports
+const (
+	StatusOnline   = "online"
+	StatusOffline  = "offline"
+	StatusDegraded = "degraded"
+)
+
+// Report represents a status report. With delta reports enabled, Services
+// of a report with Delta set only holds the services that changed since the
+// previous report, and Removed the services that are no longer monitored.
 type Report struct {
-	AgentID   string                   `json:"agent_id"`
-	Timestamp time.Time                `json:"timestamp"`
-	Status    string                   `json:"status"` // online, offline, degraded
-	Services  map[string]ServiceStatus `json:"services"`
-	Metrics   map[string]interface{}   `json:"metrics,omitempty"`
+	SchemaVersion int                      `json:"schema_version" jsonschema:"required,minimum=1"`
+	AgentID       string                   `json:"agent_id" jsonschema:"required"`
+	Version       string                   `json:"version,omitempty"`
+	BootID        string                   `json:"boot_id" jsonschema:"required"`  // changes every time the agent starts
+	Sequence      uint64                   `json:"sequence" jsonschema:"required"` // increases by one with every report published since boot
+	Timestamp     time.Time                `json:"timestamp" jsonschema:"required"`
+	Status        string                   `json:"status" jsonschema:"required,enum=online|offline|degraded"` // online, offline, degraded
+	Delta         bool                     `json:"delta,omitempty"`
+	Services      map[string]ServiceStatus `json:"services" jsonschema:"required"`
+	Removed       []string                 `json:"removed,omitempty"`
+	Metrics       map[string]interface{}   `json:"metrics,omitempty"`
 }
 
 // ServiceStatus represents the status of a monitored service
 type ServiceStatus struct {
-	Name      string        `json:"name"`
-	Status    string        `json:"status"` // up, down, degraded
-	Latency   time.Duration `json:"latency,omitempty"`
-	LastCheck time.Time     `json:"last_check"`
-	Error     string        `json:"error,omitempty"`
+	Name          string     `json:"name" jsonschema:"required"`
+	Status        string     `json:"status" jsonschema:"required,enum=up|down|degraded"` // up, down, degraded
+	LatencyMs     float64    `json:"latency_ms,omitempty" jsonschema:"minimum=0,description=check duration in milliseconds"`
+	LastCheck     time.Time  `json:"last_check" jsonschema:"required"`
+	Error         string     `json:"error,omitempty"`
+	Consensus     string     `json:"consensus,omitempty" jsonschema:"enum=up|down"` // multi-agent verdict when consensus mode is enabled
+	CertExpiresAt *time.Time `json:"cert_expires_at,omitempty"`                     // expiry of the certificate served to an HTTPS check
+}
+
+// Latency returns how long the check took
+func (s ServiceStatus) Latency() time.Duration {
+	return time.Duration(s.LatencyMs * float64(time.Millisecond))
+}
+
+// Milliseconds converts d to milliseconds with microsecond precision
+func Milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
 }
 
 // New creates a new reporter
-func New(cfg *config.Config) (*Reporter, error) {
+func New(configs *config.Store) (*Reporter, error) {
+	bootID, err := newBootID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate boot ID: %w", err)
+	}
+
 	return &Reporter{
-		config: cfg,
+		configs:  configs,
+		subjects: subjects.New(configs.Current().Nats.SubjectPrefix),
+		bootID:   bootID,
+		services: make(map[string]ServiceStatus),
 	}, nil
 }
 
+// config returns the configuration in effect
+func (r *Reporter) config() *config.Config {
+	return r.configs.Current()
+}
+
+// newBootID returns a random identifier for this run of the agent
+func newBootID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Event is a notable occurrence published on agent.event.<AgentID>.<type>
+type Event struct {
+	SchemaVersion int         `json:"schema_version"`
+	AgentID       string      `json:"agent_id"`
+	BootID        string      `json:"boot_id"`
+	Sequence      uint64      `json:"sequence"` // increases by one with every event published since boot
+	Timestamp     time.Time   `json:"timestamp"`
+	Type          string      `json:"type"`
+	Data          interface{} `json:"data,omitempty"`
+}
+
+// BootID returns the identifier of this run of the agent, carried by every
+// report and event
+func (r *Reporter) BootID() string {
+	return r.bootID
+}
+
+// MetricsProvider returns the metrics included in a report, keyed by group
+type MetricsProvider func() map[string]interface{}
+
+// SetMetricsProvider sets the function whose result fills Report.Metrics.
+// It must be called before Start.
+func (r *Reporter) SetMetricsProvider(provider MetricsProvider) {
+	r.metrics = provider
+}
+
+// SetVersion sets the agent version included in every report
+func (r *Reporter) SetVersion(version string) {
+	r.version = version
+}
+
 // Start starts the reporter
 func (r *Reporter) Start(ctx context.Context) error {
 	logging.Info("Starting reporter")
@@ -62,18 +175,22 @@ func (r *Reporter) Start(ctx context.Context) error {
 	return nil
 }
 
-// Stop stops the reporter
+// Stop stops the reporting loop and publishes a final offline report so
+// consumers learn about the shutdown without waiting for a timeout
 func (r *Reporter) Stop(ctx context.Context) error {
 	logging.Info("Stopping reporter")
 	if r.cancel != nil {
 		r.cancel()
 	}
-	return nil
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("no time left for final report: %w", err)
+	}
+	return r.sendReport(StatusOffline)
 }
 
 // reportLoop periodically sends reports
 func (r *Reporter) reportLoop(ctx context.Context) {
-	intervalSec := r.config.Agent.ReportInterval
+	intervalSec := r.config().Agent.ReportInterval
 	if intervalSec <= 0 {
 		logging.Warn("Invalid report interval; using default", "configuredSeconds", intervalSec, "defaultSeconds", defaultReportIntervalSeconds)
 		intervalSec = defaultReportIntervalSeconds
@@ -83,50 +200,232 @@ func (r *Reporter) reportLoop(ctx context.Context) {
 	defer ticker.Stop()
 
 	// Send initial report
-	r.sendReport()
+	_ = r.sendReport(StatusOnline)
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			r.sendReport()
+			_ = r.sendReport(StatusOnline)
 		}
 	}
 }
 
-// sendReport sends a status report
-func (r *Reporter) sendReport() {
-	report := Report{
-		AgentID:   r.config.Agent.AgentID,
-		Timestamp: time.Now(),
-		Status:    "online",
-		Services:  make(map[string]ServiceStatus),
-		Metrics:   make(map[string]interface{}),
+// SendNow publishes a report immediately, outside the regular interval
+func (r *Reporter) SendNow() error {
+	return r.sendReport(StatusOnline)
+}
+
+// sendReport sends a status report, as a delta if delta reports are enabled
+// and no full snapshot is due
+func (r *Reporter) sendReport(status string) error {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+
+	report := r.newReport(status)
+	services := report.Services
+
+	delta := r.config().Agent.DeltaReports
+	snapshotDue := r.published == nil || report.Timestamp.Sub(r.lastSnapshot) >= time.Duration(delta.SnapshotInterval)*time.Second
+	if delta.Enabled && status == StatusOnline && !snapshotDue {
+		report.Delta = true
+		report.Services, report.Removed = changedServices(r.published, services, delta.LatencyChange)
 	}
 
-	// TODO: Populate service statuses from actual checks
-	// For now, this is a placeholder
+	// A failed publish still uses up its sequence number, so consumers see
+	// the gap rather than a report silently missing
+	r.sequence++
+	report.Sequence = r.sequence
 
-	data, err := json.Marshal(report)
+	subject := r.subjects.Report(r.config().Agent.AgentID)
+	msg, enc, err := r.encodeReport(subject, report)
 	if err != nil {
 		logging.Error("Failed to marshal report", "error", err)
-		return
+		return err
 	}
 
 	// Publish to NATS subject using ibp-geodns-libs
-	subject := fmt.Sprintf("agent.report.%s", r.config.Agent.AgentID)
-	if err := nats.Publish(subject, data); err != nil {
+	err = nats.PublishMsg(msg)
+	metrics.ObserveReportPublish(err)
+	if err != nil {
+		r.dropped.Add(1)
+		r.mu.Lock()
+		if r.failingSince.IsZero() {
+			r.failingSince = report.Timestamp
+		}
+		r.mu.Unlock()
 		logging.Error("Failed to publish report", "error", err, "subject", subject)
-		return
+		return fmt.Errorf("failed to publish report: %w", err)
+	}
+
+	if report.Delta {
+		applyDelta(r.published, report.Services, report.Removed)
+	} else {
+		r.published = services
+		r.lastSnapshot = report.Timestamp
 	}
 
-	logging.Debug("Sent report", "subject", subject)
+	r.mu.Lock()
+	r.lastReport = report.Timestamp
+	r.failingSince = time.Time{}
+	r.mu.Unlock()
+
+	logging.Debug("Sent report", "subject", subject, "sequence", report.Sequence, "delta", report.Delta, "services", len(report.Services), "encoding", enc, "bytes", len(msg.Data))
+	return nil
+}
+
+// Snapshot returns a full report addressed to subject, carrying the
+// sequence number of the last report published. Deltas published after it
+// apply on top of it.
+func (r *Reporter) Snapshot(subject string) (*natsgo.Msg, error) {
+	r.sendMu.Lock()
+	defer r.sendMu.Unlock()
+
+	report := r.newReport(StatusOnline)
+	report.Sequence = r.sequence
+	msg, _, err := r.encodeReport(subject, report)
+	return msg, err
 }
 
-// ReportServiceStatus reports the status of a specific service
+// newReport returns a full report with the current status of every service
+func (r *Reporter) newReport(status string) Report {
+	return Report{
+		SchemaVersion: SchemaVersion,
+		AgentID:       r.config().Agent.AgentID,
+		Version:       r.version,
+		BootID:        r.bootID,
+		Timestamp:     time.Now(),
+		Status:        status,
+		Services:      r.ServiceStatuses(),
+		Metrics:       r.collectMetrics(),
+	}
+}
+
+// collectMetrics returns the metrics for a report
+func (r *Reporter) collectMetrics() map[string]interface{} {
+	var metrics map[string]interface{}
+	if r.metrics != nil {
+		metrics = r.metrics()
+	}
+	if metrics == nil {
+		metrics = make(map[string]interface{})
+	}
+	return metrics
+}
+
+// encodeReport encodes report with the configured encoding into a message
+// for subject
+func (r *Reporter) encodeReport(subject string, report Report) (*natsgo.Msg, codec.Codec, error) {
+	encoding := r.config().Agent.ReportEncoding
+	enc, err := codec.New(encoding.Format, encoding.Compression)
+	if err != nil {
+		return nil, enc, fmt.Errorf("invalid report encoding: %w", err)
+	}
+
+	msg := natsgo.NewMsg(subject)
+	if msg.Data, err = enc.Marshal(report, msg.Header); err != nil {
+		return nil, enc, fmt.Errorf("failed to marshal report: %w", err)
+	}
+	return msg, enc, nil
+}
+
+// PublishEvent publishes an event of the given type with data as its payload
+func (r *Reporter) PublishEvent(eventType string, data interface{}) error {
+	event := Event{
+		SchemaVersion: SchemaVersion,
+		AgentID:       r.config().Agent.AgentID,
+		BootID:        r.bootID,
+		Sequence:      r.eventSequence.Add(1),
+		Timestamp:     time.Now(),
+		Type:          eventType,
+		Data:          data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	subject := r.subjects.Event(r.config().Agent.AgentID, eventType)
+	if err := nats.Publish(subject, payload); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+
+	logging.Debug("Published event", "subject", subject)
+	return nil
+}
+
+// ReportServiceStatus records the latest status of a specific service; it is
+// included in every report until replaced by a newer result
 func (r *Reporter) ReportServiceStatus(serviceName string, status ServiceStatus) {
-	// This can be called from the monitoring loop to report individual service status
-	// For now, it's a placeholder
+	r.mu.Lock()
+	previous, known := r.services[serviceName]
+	r.services[serviceName] = status
+	r.mu.Unlock()
+
+	if known && previous.Status != status.Status {
+		logging.Info("Service status changed", "service", serviceName, "from", previous.Status, "to", status.Status, "error", status.Error)
+		return
+	}
 	logging.Debug("Service status update", "service", serviceName, "status", status.Status)
 }
+
+// RetainServices forgets the status of every service not named in names,
+// so services removed by a config reload drop out of reports
+func (r *Reporter) RetainServices(names []string) {
+	keep := make(map[string]bool, len(names))
+	for _, name := range names {
+		keep[name] = true
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range r.services {
+		if !keep[name] {
+			delete(r.services, name)
+		}
+	}
+}
+
+// ServiceStatus returns the latest status of a single service
+func (r *Reporter) ServiceStatus(serviceName string) (ServiceStatus, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	status, ok := r.services[serviceName]
+	return status, ok
+}
+
+// ServiceStatuses returns a copy of the latest status of every checked service
+func (r *Reporter) ServiceStatuses() map[string]ServiceStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	statuses := make(map[string]ServiceStatus, len(r.services))
+	for name, status := range r.services {
+		statuses[name] = status
+	}
+	return statuses
+}
+
+// FailingSince returns when report publishing started failing, or the zero
+// time if the last attempt succeeded
+func (r *Reporter) FailingSince() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.failingSince
+}
+
+// Dropped returns the number of reports that could not be published since
+// the agent started
+func (r *Reporter) Dropped() uint64 {
+	return r.dropped.Load()
+}
+
+// LastReport returns when the last report was published successfully, or the
+// zero time if none has been published yet
+func (r *Reporter) LastReport() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastReport
+}
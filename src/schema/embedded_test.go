@@ -0,0 +1,36 @@
+package schema_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+	"github.com/ibp-network/ibp-geodns-agent/src/schema"
+)
+
+// TestEmbeddedSchemasUpToDate fails when the Go types changed without
+// running go generate
+func TestEmbeddedSchemasUpToDate(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		id       string
+		title    string
+		embedded []byte
+	}{
+		{"config", &config.Config{}, schema.ConfigID, "ibp-geodns-agent configuration", schema.Config()},
+		{"report", &reporter.Report{}, schema.ReportID, "ibp-geodns-agent report", schema.Report()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := schema.Generate(tt.value, tt.id, tt.title)
+			if err != nil {
+				t.Fatalf("Generate: %v", err)
+			}
+			if !bytes.Equal(data, tt.embedded) {
+				t.Errorf("%s.schema.json is out of date; run go generate ./src/schema", tt.name)
+			}
+		})
+	}
+}
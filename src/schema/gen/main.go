@@ -0,0 +1,34 @@
+// Command gen writes the JSON Schema files embedded by package schema.
+// It is run via `go generate ./src/schema` (or `make schema`).
+package main
+
+import (
+	"log"
+	"os"
+
+	"github.com/ibp-network/ibp-geodns-agent/src/config"
+	"github.com/ibp-network/ibp-geodns-agent/src/reporter"
+	"github.com/ibp-network/ibp-geodns-agent/src/schema"
+)
+
+func main() {
+	targets := []struct {
+		file  string
+		value interface{}
+		id    string
+		title string
+	}{
+		{"config.schema.json", &config.Config{}, schema.ConfigID, "ibp-geodns-agent configuration"},
+		{"report.schema.json", &reporter.Report{}, schema.ReportID, "ibp-geodns-agent report"},
+	}
+
+	for _, target := range targets {
+		data, err := schema.Generate(target.value, target.id, target.title)
+		if err != nil {
+			log.Fatalf("generate %s: %v", target.file, err)
+		}
+		if err := os.WriteFile(target.file, data, 0o644); err != nil {
+			log.Fatalf("write %s: %v", target.file, err)
+		}
+	}
+}
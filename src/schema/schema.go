@@ -0,0 +1,52 @@
+// Package schema publishes JSON Schemas for the agent configuration file and
+// the report payloads published over NATS.
+//
+// The schema files are generated from the Go types by `go generate` (see
+// gen/main.go) and embedded into the binary.
+package schema
+
+import (
+	_ "embed"
+)
+
+//go:generate go run ./gen
+
+// Schema IDs
+const (
+	ConfigID = "https://github.com/ibp-network/ibp-geodns-agent/schema/config.schema.json"
+	ReportID = "https://github.com/ibp-network/ibp-geodns-agent/schema/report.schema.json"
+)
+
+var (
+	//go:embed config.schema.json
+	configSchema []byte
+
+	//go:embed report.schema.json
+	reportSchema []byte
+)
+
+// Config returns the JSON Schema for the agent configuration file
+func Config() []byte {
+	return configSchema
+}
+
+// Report returns the JSON Schema for reporter.Report payloads
+func Report() []byte {
+	return reportSchema
+}
+
+// Lookup returns the schema with the given name ("config" or "report")
+func Lookup(name string) ([]byte, bool) {
+	switch name {
+	case "config":
+		return configSchema, true
+	case "report":
+		return reportSchema, true
+	}
+	return nil, false
+}
+
+// Names returns the names accepted by Lookup
+func Names() []string {
+	return []string{"config", "report"}
+}
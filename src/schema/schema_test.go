@@ -0,0 +1,162 @@
+package schema
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testService struct {
+	Name    string `json:"Name" jsonschema:"required"`
+	Type    string `json:"Type" jsonschema:"enum=http|tcp"`
+	Timeout int    `json:"Timeout,omitempty" jsonschema:"minimum=0,maximum=60"`
+	Weight  float64
+	Skipped string `json:"-"`
+	hidden  string // unexported fields are not part of the schema
+}
+
+type testDoc struct {
+	ID       string            `json:"id" jsonschema:"required,format=uri,description=document ID"`
+	Enabled  bool              `json:"enabled"`
+	At       time.Time         `json:"at"`
+	Every    time.Duration     `json:"every"`
+	Services []testService     `json:"services"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Raw      []byte            `json:"raw,omitempty"`
+	Extra    interface{}       `json:"extra,omitempty"`
+	Parent   *testService      `json:"parent,omitempty"`
+}
+
+func generateTestSchema(t *testing.T) (map[string]interface{}, []byte) {
+	t.Helper()
+	data, err := Generate(&testDoc{}, "https://example.com/test.json", "test")
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	var s map[string]interface{}
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("generated schema is not JSON: %v", err)
+	}
+	return s, data
+}
+
+// at walks the generated schema along the given keys
+func at(t *testing.T, s map[string]interface{}, keys ...string) interface{} {
+	t.Helper()
+	var cur interface{} = s
+	for _, key := range keys {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s: not an object", strings.Join(keys, "."))
+		}
+		cur = obj[key]
+	}
+	return cur
+}
+
+func TestGenerate(t *testing.T) {
+	s, _ := generateTestSchema(t)
+	props := []string{"properties"}
+	service := []string{"properties", "services", "items", "properties"}
+
+	tests := []struct {
+		name string
+		path []string
+		want interface{}
+	}{
+		{"draft", []string{"$schema"}, draft},
+		{"id", []string{"$id"}, "https://example.com/test.json"},
+		{"closed structs", []string{"additionalProperties"}, false},
+		{"required", []string{"required"}, []interface{}{"id"}},
+		{"string", append(props, "id", "type"), "string"},
+		{"format", append(props, "id", "format"), "uri"},
+		{"description", append(props, "id", "description"), "document ID"},
+		{"boolean", append(props, "enabled", "type"), "boolean"},
+		{"time", append(props, "at", "format"), "date-time"},
+		{"duration", append(props, "every", "type"), "integer"},
+		{"slice", append(props, "services", "type"), []interface{}{"array", "null"}},
+		{"nullable map", append(props, "labels", "type"), []interface{}{"object", "null"}},
+		{"map", append(props, "labels", "additionalProperties", "type"), "string"},
+		{"bytes", append(props, "raw", "contentEncoding"), "base64"},
+		{"interface", append(props, "extra"), map[string]interface{}{}},
+		{"pointer", append(props, "parent", "type"), "object"},
+		{"nested required", []string{"properties", "services", "items", "required"}, []interface{}{"Name"}},
+		{"enum", append(service, "Type", "enum"), []interface{}{"http", "tcp"}},
+		{"minimum", append(service, "Timeout", "minimum"), 0.0},
+		{"maximum", append(service, "Timeout", "maximum"), 60.0},
+		{"untagged name", append(service, "Weight", "type"), "number"},
+		{"skipped field", append(service, "Skipped"), nil},
+		{"unexported field", append(service, "hidden"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := at(t, s, tt.path...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", strings.Join(tt.path, "."), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	_, schemaData := generateTestSchema(t)
+
+	tests := []struct {
+		name   string
+		doc    string
+		issues []string // "path keyword"
+	}{
+		{"valid", `{"id": "x", "services": [{"Name": "a", "Type": "http", "Timeout": 5}]}`, nil},
+		{"missing required", `{"services": [{"Type": "tcp"}]}`, []string{"id required", "services[0].Name required"}},
+		{"case-insensitive names", `{"ID": "x", "Services": [{"name": "a"}]}`, nil},
+		{"wrong type", `{"id": 1, "enabled": "yes"}`, []string{"enabled type", "id type"}},
+		{"integer", `{"id": "x", "services": [{"Name": "a", "Timeout": 1.5}]}`, []string{"services[0].Timeout type"}},
+		{"enum", `{"id": "x", "services": [{"Name": "a", "Type": "udp"}]}`, []string{"services[0].Type enum"}},
+		{"range", `{"id": "x", "services": [{"Name": "a", "Timeout": -1}, {"Name": "b", "Timeout": 61}]}`, []string{"services[0].Timeout minimum", "services[1].Timeout maximum"}},
+		{"unknown field", `{"id": "x", "colour": "blue"}`, []string{"colour additionalProperties"}},
+		{"map values", `{"id": "x", "labels": {"a": "b", "c": 1}}`, []string{"labels.c type"}},
+		{"null slice and map", `{"id": "x", "services": null, "labels": null}`, nil},
+		{"slice of the wrong type", `{"id": "x", "services": "a"}`, []string{"services type"}},
+		{"any value", `{"id": "x", "extra": [1, "two", {"three": 3}]}`, nil},
+		{"every problem", `{"enabled": 1, "services": [{"Name": "a", "Type": "udp", "Timeout": -1, "Extra": true}]}`,
+			[]string{"id required", "enabled type", "services[0].Extra additionalProperties", "services[0].Timeout minimum", "services[0].Type enum"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			found, err := Validate(schemaData, []byte(tt.doc))
+			if err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			var got []string
+			for _, issue := range found {
+				got = append(got, issue.Path+" "+issue.Keyword)
+			}
+			if !reflect.DeepEqual(got, tt.issues) {
+				t.Errorf("issues = %v, want %v", got, tt.issues)
+			}
+		})
+	}
+}
+
+func TestValidateMalformed(t *testing.T) {
+	_, schemaData := generateTestSchema(t)
+	if _, err := Validate(schemaData, []byte(`{"id": `)); err == nil {
+		t.Error("malformed document accepted")
+	}
+	if _, err := Validate([]byte(`{`), []byte(`{}`)); err == nil {
+		t.Error("malformed schema accepted")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for _, name := range Names() {
+		data, ok := Lookup(name)
+		if !ok || !json.Valid(data) {
+			t.Errorf("Lookup(%q) returned no valid schema", name)
+		}
+	}
+	if _, ok := Lookup("unknown"); ok {
+		t.Error("Lookup of an unknown schema succeeded")
+	}
+}
@@ -0,0 +1,227 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Keywords reported in Issue.Keyword
+const (
+	KeywordType                 = "type"
+	KeywordRequired             = "required"
+	KeywordAdditionalProperties = "additionalProperties"
+	KeywordEnum                 = "enum"
+	KeywordMinimum              = "minimum"
+	KeywordMaximum              = "maximum"
+)
+
+// Issue is a single schema violation
+type Issue struct {
+	Path    string `json:"path"`
+	Keyword string `json:"keyword"`
+	Message string `json:"message"`
+}
+
+// String returns the issue formatted as "path: message"
+func (i Issue) String() string {
+	if i.Path == "" {
+		return i.Message
+	}
+	return i.Path + ": " + i.Message
+}
+
+// Validate checks the JSON document data against the JSON Schema in
+// schemaData and returns every violation found.
+//
+// Only the subset of JSON Schema emitted by Generate is supported: type,
+// properties, required, additionalProperties, items, enum, minimum and
+// maximum. Property names are matched case-insensitively when there is no
+// exact match, mirroring how encoding/json decodes into Go structs.
+func Validate(schemaData, data []byte) ([]Issue, error) {
+	var s map[string]interface{}
+	if err := json.Unmarshal(schemaData, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse document: %w", err)
+	}
+
+	var issues []Issue
+	validateValue(s, doc, "", &issues)
+	return issues, nil
+}
+
+func validateValue(s map[string]interface{}, value interface{}, path string, issues *[]Issue) {
+	add := func(keyword, format string, args ...interface{}) {
+		*issues = append(*issues, Issue{Path: path, Keyword: keyword, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if want := schemaTypes(s); len(want) > 0 && !matchesAnyType(want, value) {
+		add(KeywordType, "expected %s, got %s", strings.Join(want, " or "), jsonType(value))
+		return
+	}
+
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if candidate == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			add(KeywordEnum, "value %v is not one of %v", value, enum)
+		}
+	}
+
+	if n, ok := value.(float64); ok {
+		if min, ok := s["minimum"].(float64); ok && n < min {
+			add(KeywordMinimum, "must be >= %v, got %v", min, n)
+		}
+		if max, ok := s["maximum"].(float64); ok && n > max {
+			add(KeywordMaximum, "must be <= %v, got %v", max, n)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		validateObject(s, v, path, issues)
+	case []interface{}:
+		items, ok := s["items"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		for i, item := range v {
+			validateValue(items, item, fmt.Sprintf("%s[%d]", path, i), issues)
+		}
+	}
+}
+
+func validateObject(s map[string]interface{}, obj map[string]interface{}, path string, issues *[]Issue) {
+	properties, _ := s["properties"].(map[string]interface{})
+
+	if required, ok := s["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, ok := lookupFold(obj, name); !ok {
+				*issues = append(*issues, Issue{Path: join(path, name), Keyword: KeywordRequired, Message: "is required"})
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := join(path, key)
+		if propName, ok := lookupFoldKey(properties, key); ok {
+			if prop, ok := properties[propName].(map[string]interface{}); ok {
+				validateValue(prop, obj[key], keyPath, issues)
+			}
+			continue
+		}
+
+		switch extra := s["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				*issues = append(*issues, Issue{Path: keyPath, Keyword: KeywordAdditionalProperties, Message: "unknown field"})
+			}
+		case map[string]interface{}:
+			validateValue(extra, obj[key], keyPath, issues)
+		}
+	}
+}
+
+// schemaTypes returns the types allowed by s, given as a single type or a
+// list of types
+func schemaTypes(s map[string]interface{}) []string {
+	switch t := s["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, v := range t {
+			if name, ok := v.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func matchesAnyType(want []string, value interface{}) bool {
+	for _, w := range want {
+		if matchesType(w, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesType(want string, value interface{}) bool {
+	switch want {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	default:
+		return jsonType(value) == want
+	}
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func lookupFold(obj map[string]interface{}, name string) (interface{}, bool) {
+	key, ok := lookupFoldKey(obj, name)
+	if !ok {
+		return nil, false
+	}
+	return obj[key], true
+}
+
+func lookupFoldKey(obj map[string]interface{}, name string) (string, bool) {
+	if _, ok := obj[name]; ok {
+		return name, true
+	}
+	for key := range obj {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
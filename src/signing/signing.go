@@ -0,0 +1,192 @@
+// Package signing signs agent messages with an ed25519 nkey and verifies
+// them, so consumers can tell reports and events of a real agent from ones
+// forged by another NATS client.
+//
+// The signature covers the subject and the payload. It is carried in the
+// Ibp-Agent-Signature header, base64url encoded, next to the signer's
+// public key in Ibp-Agent-Key.
+package signing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// Message headers carrying the signature
+const (
+	HeaderKey       = "Ibp-Agent-Key"
+	HeaderSignature = "Ibp-Agent-Signature"
+)
+
+// Verification errors
+var (
+	ErrUnsigned        = errors.New("message is not signed")
+	ErrInvalidKey      = errors.New("invalid signing key")
+	ErrInvalidSig      = errors.New("invalid signature")
+	ErrKeyMismatch     = errors.New("message signed with a key not pinned for this agent")
+	ErrInvalidRotation = errors.New("invalid key rotation")
+)
+
+// KeyRotation is the payload of the event announcing a new signing key. It
+// is signed with the old key, so consumers that pinned the old key can
+// trust the new one.
+type KeyRotation struct {
+	OldKey string `json:"old_key"`
+	NewKey string `json:"new_key"`
+}
+
+// Signer signs messages with an nkey
+type Signer struct {
+	kp        nkeys.KeyPair
+	publicKey string
+}
+
+// LoadSigner reads an nkey seed file, such as one created with
+// `nk -gen user`
+func LoadSigner(seedFile string) (*Signer, error) {
+	data, err := os.ReadFile(seedFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing seed: %w", err)
+	}
+	kp, err := nkeys.ParseDecoratedNKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing seed %s: %w", seedFile, err)
+	}
+	publicKey, err := kp.PublicKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive public key: %w", err)
+	}
+	return &Signer{kp: kp, publicKey: publicKey}, nil
+}
+
+// PublicKey returns the signer's public nkey
+func (s *Signer) PublicKey() string {
+	return s.publicKey
+}
+
+// Sign adds the signature headers for a message on subject with data to header
+func (s *Signer) Sign(subject string, data []byte, header natsgo.Header) error {
+	sig, err := s.kp.Sign(signedBytes(subject, data))
+	if err != nil {
+		return fmt.Errorf("failed to sign message: %w", err)
+	}
+	header.Set(HeaderKey, s.publicKey)
+	header.Set(HeaderSignature, base64.RawURLEncoding.EncodeToString(sig))
+	return nil
+}
+
+// Verify checks the signature of msg and returns the public key that signed
+// it. A valid signature only proves who holds the key; use a KeyRing or
+// compare the key with a known one to tie it to an agent.
+func Verify(msg *natsgo.Msg) (string, error) {
+	publicKey := msg.Header.Get(HeaderKey)
+	encoded := msg.Header.Get(HeaderSignature)
+	if publicKey == "" || encoded == "" {
+		return "", ErrUnsigned
+	}
+
+	kp, err := nkeys.FromPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSig, err)
+	}
+	if err := kp.Verify(signedBytes(msg.Subject, msg.Data), sig); err != nil {
+		return "", ErrInvalidSig
+	}
+	return publicKey, nil
+}
+
+// signedBytes is the signed input: the subject, a newline and the payload
+func signedBytes(subject string, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(subject) + 1 + len(data))
+	buf.WriteString(subject)
+	buf.WriteByte('\n')
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+// KeyRing pins the key of every agent on first use and rejects messages
+// signed with any other key until a rotation signed by the pinned key is
+// accepted
+type KeyRing struct {
+	mu   sync.Mutex
+	keys map[string]string // AgentID -> public key
+}
+
+// NewKeyRing creates a key ring, optionally seeded with known keys
+func NewKeyRing(trusted map[string]string) *KeyRing {
+	keys := make(map[string]string, len(trusted))
+	for agentID, key := range trusted {
+		keys[agentID] = key
+	}
+	return &KeyRing{keys: keys}
+}
+
+// Verify checks that msg was signed by the key pinned for agentID, pinning
+// the signing key if the agent is new. Only a valid signature pins a key;
+// unsigned messages and bad signatures leave the ring unchanged.
+func (k *KeyRing) Verify(agentID string, msg *natsgo.Msg) error {
+	publicKey, err := Verify(msg)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	pinned, ok := k.keys[agentID]
+	if !ok {
+		k.keys[agentID] = publicKey
+		return nil
+	}
+	if pinned != publicKey {
+		return ErrKeyMismatch
+	}
+	return nil
+}
+
+// Rotate pins rotation.NewKey for agentID if msg, the rotation event, was
+// signed by the currently pinned key
+func (k *KeyRing) Rotate(agentID string, msg *natsgo.Msg, rotation KeyRotation) error {
+	if !nkeys.IsValidPublicKey(rotation.NewKey) {
+		return fmt.Errorf("%w: new key %q is not a public nkey", ErrInvalidRotation, rotation.NewKey)
+	}
+	publicKey, err := Verify(msg)
+	if err != nil {
+		return err
+	}
+
+	// A rotation moves an existing pin; it never pins a key of its own
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	pinned, ok := k.keys[agentID]
+	if !ok {
+		return fmt.Errorf("%w: no key pinned for %s", ErrInvalidRotation, agentID)
+	}
+	if pinned != publicKey {
+		return ErrKeyMismatch
+	}
+	if publicKey != rotation.OldKey {
+		return fmt.Errorf("%w: signed with a key other than old_key", ErrInvalidRotation)
+	}
+	k.keys[agentID] = rotation.NewKey
+	return nil
+}
+
+// Key returns the key pinned for agentID
+func (k *KeyRing) Key(agentID string) (string, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key, ok := k.keys[agentID]
+	return key, ok
+}
@@ -0,0 +1,214 @@
+package signing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	natsgo "github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// newTestSigner creates a signer with a fresh user key
+func newTestSigner(t *testing.T) *Signer {
+	t.Helper()
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	publicKey, err := kp.PublicKey()
+	if err != nil {
+		t.Fatalf("PublicKey: %v", err)
+	}
+	return &Signer{kp: kp, publicKey: publicKey}
+}
+
+// signedMsg returns a message on subject with data, signed by s unless s is nil
+func signedMsg(t *testing.T, s *Signer, subject string, data []byte) *natsgo.Msg {
+	t.Helper()
+	msg := &natsgo.Msg{Subject: subject, Data: data, Header: natsgo.Header{}}
+	if s != nil {
+		if err := s.Sign(subject, data, msg.Header); err != nil {
+			t.Fatalf("Sign: %v", err)
+		}
+	}
+	return msg
+}
+
+func TestKeyRingPinsOnlyValidSignatures(t *testing.T) {
+	signer := newTestSigner(t)
+	ring := NewKeyRing(nil)
+
+	unsigned := signedMsg(t, nil, "agent.report.a1", []byte("{}"))
+	if err := ring.Verify("a1", unsigned); !errors.Is(err, ErrUnsigned) {
+		t.Errorf("unsigned message: got %v, want ErrUnsigned", err)
+	}
+	forged := signedMsg(t, signer, "agent.report.a1", []byte("{}"))
+	forged.Data = []byte(`{"status":"offline"}`)
+	if err := ring.Verify("a1", forged); !errors.Is(err, ErrInvalidSig) {
+		t.Errorf("forged message: got %v, want ErrInvalidSig", err)
+	}
+	if key, ok := ring.Key("a1"); ok {
+		t.Fatalf("key %s pinned by a message that failed verification", key)
+	}
+
+	if err := ring.Verify("a1", signedMsg(t, signer, "agent.report.a1", []byte("{}"))); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if key, _ := ring.Key("a1"); key != signer.PublicKey() {
+		t.Errorf("pinned %q, want %q", key, signer.PublicKey())
+	}
+}
+
+func TestKeyRingRotateNeedsPinnedKey(t *testing.T) {
+	oldSigner, newSigner := newTestSigner(t), newTestSigner(t)
+	ring := NewKeyRing(nil)
+	rotation := KeyRotation{OldKey: oldSigner.PublicKey(), NewKey: newSigner.PublicKey()}
+
+	msg := signedMsg(t, oldSigner, "agent.event.a1.signing_key_rotated", []byte("{}"))
+	if err := ring.Rotate("a1", msg, rotation); !errors.Is(err, ErrInvalidRotation) {
+		t.Errorf("rotation of an unknown agent: got %v, want ErrInvalidRotation", err)
+	}
+	if key, ok := ring.Key("a1"); ok {
+		t.Errorf("rotation of an unknown agent pinned %s", key)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	signer := newTestSigner(t)
+	data := []byte(`{"agent_id":"a1","status":"online"}`)
+
+	tests := []struct {
+		name   string
+		modify func(msg *natsgo.Msg)
+		err    error
+	}{
+		{"valid", func(msg *natsgo.Msg) {}, nil},
+		{"tampered payload", func(msg *natsgo.Msg) { msg.Data = []byte(`{"agent_id":"a1","status":"offline"}`) }, ErrInvalidSig},
+		{"replayed on another subject", func(msg *natsgo.Msg) { msg.Subject = "agent.report.a2" }, ErrInvalidSig},
+		{"no signature", func(msg *natsgo.Msg) { msg.Header.Del(HeaderSignature) }, ErrUnsigned},
+		{"no key", func(msg *natsgo.Msg) { msg.Header.Del(HeaderKey) }, ErrUnsigned},
+		{"key of another signer", func(msg *natsgo.Msg) { msg.Header.Set(HeaderKey, newTestSigner(t).PublicKey()) }, ErrInvalidSig},
+		{"malformed key", func(msg *natsgo.Msg) { msg.Header.Set(HeaderKey, "not-a-key") }, ErrInvalidKey},
+		{"malformed signature", func(msg *natsgo.Msg) { msg.Header.Set(HeaderSignature, "!!") }, ErrInvalidSig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := signedMsg(t, signer, "agent.report.a1", data)
+			tt.modify(msg)
+			publicKey, err := Verify(msg)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify: got %v, want %v", err, tt.err)
+			}
+			if err == nil && publicKey != signer.PublicKey() {
+				t.Errorf("signed by %q, want %q", publicKey, signer.PublicKey())
+			}
+		})
+	}
+}
+
+func TestKeyRingKeyMismatch(t *testing.T) {
+	trusted, pinned, other := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	ring := NewKeyRing(map[string]string{"a1": trusted.PublicKey()})
+
+	// A trusted key is never replaced by first use
+	if err := ring.Verify("a1", signedMsg(t, other, "agent.report.a1", nil)); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("trusted agent signed by another key: got %v, want ErrKeyMismatch", err)
+	}
+	if err := ring.Verify("a1", signedMsg(t, trusted, "agent.report.a1", nil)); err != nil {
+		t.Errorf("trusted key: %v", err)
+	}
+
+	// Nor is a pinned one
+	if err := ring.Verify("a2", signedMsg(t, pinned, "agent.report.a2", nil)); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := ring.Verify("a2", signedMsg(t, other, "agent.report.a2", nil)); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("pinned agent signed by another key: got %v, want ErrKeyMismatch", err)
+	}
+	if key, _ := ring.Key("a2"); key != pinned.PublicKey() {
+		t.Errorf("pin moved to %q", key)
+	}
+}
+
+func TestKeyRingRotate(t *testing.T) {
+	oldSigner, newSigner, other := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	subject := "agent.event.a1.signing_key_rotated"
+
+	tests := []struct {
+		name     string
+		signer   *Signer
+		rotation KeyRotation
+		err      error
+	}{
+		{"signed by the pinned key", oldSigner, KeyRotation{OldKey: oldSigner.PublicKey(), NewKey: newSigner.PublicKey()}, nil},
+		{"signed by another key", other, KeyRotation{OldKey: other.PublicKey(), NewKey: newSigner.PublicKey()}, ErrKeyMismatch},
+		{"old_key is not the signer", oldSigner, KeyRotation{OldKey: other.PublicKey(), NewKey: newSigner.PublicKey()}, ErrInvalidRotation},
+		{"new key is not a public key", oldSigner, KeyRotation{OldKey: oldSigner.PublicKey(), NewKey: "SUSEED"}, ErrInvalidRotation},
+		{"unsigned", nil, KeyRotation{OldKey: oldSigner.PublicKey(), NewKey: newSigner.PublicKey()}, ErrUnsigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := NewKeyRing(map[string]string{"a1": oldSigner.PublicKey()})
+			err := ring.Rotate("a1", signedMsg(t, tt.signer, subject, []byte("{}")), tt.rotation)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Rotate: got %v, want %v", err, tt.err)
+			}
+
+			want := oldSigner.PublicKey()
+			if err == nil {
+				want = newSigner.PublicKey()
+			}
+			if key, _ := ring.Key("a1"); key != want {
+				t.Errorf("pinned %q, want %q", key, want)
+			}
+		})
+	}
+
+	// After a rotation only the new key is accepted
+	ring := NewKeyRing(map[string]string{"a1": oldSigner.PublicKey()})
+	rotation := KeyRotation{OldKey: oldSigner.PublicKey(), NewKey: newSigner.PublicKey()}
+	if err := ring.Rotate("a1", signedMsg(t, oldSigner, subject, []byte("{}")), rotation); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if err := ring.Verify("a1", signedMsg(t, newSigner, "agent.report.a1", nil)); err != nil {
+		t.Errorf("new key: %v", err)
+	}
+	if err := ring.Verify("a1", signedMsg(t, oldSigner, "agent.report.a1", nil)); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("old key after rotation: got %v, want ErrKeyMismatch", err)
+	}
+}
+
+func TestLoadSigner(t *testing.T) {
+	kp, err := nkeys.CreateUser()
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	seed, _ := kp.Seed()
+	publicKey, _ := kp.PublicKey()
+
+	dir := t.TempDir()
+	seedFile := filepath.Join(dir, "agent.nk")
+	if err := os.WriteFile(seedFile, seed, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := LoadSigner(seedFile)
+	if err != nil {
+		t.Fatalf("LoadSigner: %v", err)
+	}
+	if signer.PublicKey() != publicKey {
+		t.Errorf("public key %q, want %q", signer.PublicKey(), publicKey)
+	}
+
+	if _, err := LoadSigner(filepath.Join(dir, "missing.nk")); err == nil {
+		t.Error("missing seed file loaded")
+	}
+	garbage := filepath.Join(dir, "garbage.nk")
+	if err := os.WriteFile(garbage, []byte("not a seed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSigner(garbage); err == nil {
+		t.Error("malformed seed file loaded")
+	}
+}
@@ -0,0 +1,140 @@
+// Package subjects builds every NATS subject the agent publishes or
+// subscribes to, so the namespace and escaping rules live in one place.
+package subjects
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Broadcast is the command target addressing every agent
+const Broadcast = "all"
+
+// Builder builds subjects under an optional namespace prefix
+type Builder struct {
+	prefix string
+}
+
+// New returns a builder that prefixes every subject with prefix. An empty
+// prefix yields the unprefixed agent.* subjects.
+func New(prefix string) Builder {
+	return Builder{prefix: strings.Trim(strings.TrimSpace(prefix), ".")}
+}
+
+// Prefix returns the namespace prefix, if any
+func (b Builder) Prefix() string {
+	return b.prefix
+}
+
+// Report is the subject an agent publishes its reports on
+func (b Builder) Report(agentID string) string {
+	return b.join("agent", "report", Token(agentID))
+}
+
+// AllReports matches every agent's reports
+func (b Builder) AllReports() string {
+	return b.join("agent", "report", "*")
+}
+
+// Snapshot is the subject on which an agent answers requests for a full
+// report; subjects.Broadcast addresses every agent
+func (b Builder) Snapshot(agentID string) string {
+	return b.join("agent", "snapshot", Token(agentID))
+}
+
+// Event is the subject of an event of the given type
+func (b Builder) Event(agentID, eventType string) string {
+	return b.join("agent", "event", Token(agentID), Token(eventType))
+}
+
+// AllEvents matches events of the given type from every agent
+func (b Builder) AllEvents(eventType string) string {
+	return b.join("agent", "event", "*", Token(eventType))
+}
+
+// Audit is the subject an agent publishes audit events on
+func (b Builder) Audit(agentID string) string {
+	return b.join("agent", "audit", Token(agentID))
+}
+
+// Commands matches every command addressed to the agent, or to all agents
+// when agentID is Broadcast
+func (b Builder) Commands(agentID string) string {
+	return b.join("agent", "cmd", Token(agentID), "*")
+}
+
+// Command is the subject of a single command sent to an agent
+func (b Builder) Command(agentID, command string) string {
+	return b.join("agent", "cmd", Token(agentID), Token(command))
+}
+
+// Observation is the subject an agent publishes consensus observations on
+func (b Builder) Observation(agentID string) string {
+	return b.join("agent", "observation", Token(agentID))
+}
+
+// AllObservations matches every agent's consensus observations
+func (b Builder) AllObservations() string {
+	return b.join("agent", "observation", "*")
+}
+
+// Service is the subject group of the agent's micro service endpoints
+func (b Builder) Service(agentID string) string {
+	return b.join("agent", "svc", Token(agentID))
+}
+
+// AgentToken returns the agent token of a subject built for one agent, such
+// as a report, event or observation subject
+func (b Builder) AgentToken(subject string) (string, bool) {
+	if b.prefix != "" {
+		if !strings.HasPrefix(subject, b.prefix+".") {
+			return "", false
+		}
+		subject = strings.TrimPrefix(subject, b.prefix+".")
+	}
+	tokens := strings.Split(subject, ".")
+	if len(tokens) < 3 || tokens[0] != "agent" {
+		return "", false
+	}
+	return tokens[2], true
+}
+
+func (b Builder) join(tokens ...string) string {
+	subject := strings.Join(tokens, ".")
+	if b.prefix == "" {
+		return subject
+	}
+	return b.prefix + "." + subject
+}
+
+// Token makes s safe to use as a single subject token. Dots, wildcards,
+// whitespace and control characters would split or widen the subject, so
+// they are replaced with underscores.
+func Token(s string) string {
+	if s == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r == '.', r == '*', r == '>', unicode.IsSpace(r), unicode.IsControl(r):
+			return '_'
+		default:
+			return r
+		}
+	}, s)
+}
+
+// ValidPrefix reports whether prefix can be used as a namespace: one or more
+// dot-separated tokens without wildcards or whitespace
+func ValidPrefix(prefix string) bool {
+	prefix = strings.Trim(strings.TrimSpace(prefix), ".")
+	if prefix == "" {
+		return true
+	}
+	for _, token := range strings.Split(prefix, ".") {
+		if token == "" || Token(token) != token {
+			return false
+		}
+	}
+	return true
+}
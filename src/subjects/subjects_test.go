@@ -0,0 +1,30 @@
+package subjects
+
+import "testing"
+
+func TestAgentToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefix  string
+		subject string
+		want    string
+		ok      bool
+	}{
+		{"report", "", New("").Report("agent-1"), "agent-1", true},
+		{"event", "", New("").Event("agent-1", "service_down"), "agent-1", true},
+		{"escaped agent ID", "", New("").Observation("eu.1"), "eu_1", true},
+		{"prefixed", "prod", New("prod").Report("agent-1"), "agent-1", true},
+		{"other prefix", "prod", New("staging").Report("agent-1"), "", false},
+		{"missing prefix", "prod", New("").Report("agent-1"), "", false},
+		{"not an agent subject", "", "other.report.agent-1", "", false},
+		{"too short", "", "agent.report", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := New(tt.prefix).AgentToken(tt.subject)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("AgentToken(%q) = %q %v, want %q %v", tt.subject, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}